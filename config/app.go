@@ -1,7 +1,75 @@
 package config
 
+// DefaultProvider is the DNS provider used for records which do not specify one.
+const DefaultProvider = "porkbun"
+
 // App contains all application settings.
 type App struct {
 	Record
-	Porkbun
+	Schedule
+	State
+	// Detection specifies how the current IP addresses are detected.
+	Detection Detection
+	// HTTP specifies how HTTP requests are made.
+	HTTP HTTP
+	// Logging specifies how messages are logged.
+	Logging Logging
+	// Metrics specifies how metrics are served.
+	Metrics Metrics
+	// Porkbun holds the credentials used for records hosted by Porkbun.
+	Porkbun Porkbun
+	// Cloudflare holds the credentials used for records hosted by Cloudflare.
+	Cloudflare Cloudflare
+	// RFC2136 holds the server and TSIG key used for records updated with RFC 2136 dynamic updates.
+	RFC2136 RFC2136
+	// Records lists additional records to update. These can only be set from a config file.
+	Records []Record `json:",omitempty"`
+	// Notifications lists where events are notified. These can only be set from a config file.
+	Notifications []Notification `json:",omitempty"`
+}
+
+// AllRecords returns every record which should be updated. The top level record is included first
+// if it has been configured.
+func (a *App) AllRecords() []Record {
+	var r []Record
+	if a.Record.Domain != "" || len(a.Records) == 0 {
+		r = append(r, a.Record)
+	}
+	return append(r, a.Records...)
+}
+
+// ProviderFor returns the name of the DNS provider hosting the given record. Records inherit the
+// provider of the top level record unless they specify their own.
+func (a *App) ProviderFor(r Record) string {
+	if r.Provider != "" {
+		return r.Provider
+	}
+	if a.Record.Provider != "" {
+		return a.Record.Provider
+	}
+	return DefaultProvider
+}
+
+// PorkbunFor returns the Porkbun credentials to use for the given record.
+func (a *App) PorkbunFor(r Record) Porkbun {
+	if r.Porkbun != nil {
+		return *r.Porkbun
+	}
+	return a.Porkbun
+}
+
+// CloudflareFor returns the Cloudflare credentials to use for the given record.
+func (a *App) CloudflareFor(r Record) Cloudflare {
+	if r.Cloudflare != nil {
+		return *r.Cloudflare
+	}
+	return a.Cloudflare
+}
+
+// RFC2136For returns the RFC 2136 settings to use for the given record.
+func (a *App) RFC2136For(r Record) RFC2136 {
+	if r.RFC2136 != nil {
+		return *r.RFC2136
+	}
+	return a.RFC2136
 }
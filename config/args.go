@@ -1,18 +1,57 @@
 package config
 
-import "github.com/alexflint/go-arg"
+import (
+	"os"
 
-// Args contains configuration arguments which can be set from the command line.
+	"github.com/alexflint/go-arg"
+)
+
+// Args contains configuration arguments which can be set from the command line. Apart from those
+// selecting what is done, they can also be set from DDCLIENT_* environment variables, which are
+// overridden by the command line.
 type Args struct {
 	Record
 	Porkbun
-	ConfigFilePath string `arg:"--config" help:"config file to use"`
-	Save           bool   `help:"save configs to file (no other action is taken)"`
+	Cloudflare
+	RFC2136
+	Schedule
+	State
+	Detection
+	HTTP
+	Logging
+	Metrics
+	ConfigFilePath string     `arg:"--config" help:"config file to use, in YAML (.yaml or .yml), TOML (.toml) or otherwise JSON format [env: DDCLIENT_CONFIG]"`
+	Save           bool       `env:"-" help:"save configs to file (no other action is taken)"`
+	Daemon         bool       `env:"-" help:"keep running and update the record whenever the IP address changes"`
+	DryRun         bool       `arg:"--dry-run" env:"-" help:"show planned DNS changes without applying them"`
+	Config         *ConfigCmd `arg:"subcommand:config" env:"-" help:"manage the configuration"`
+}
+
+// ConfigCmd contains the config subcommands.
+type ConfigCmd struct {
+	Validate *ValidateCmd `arg:"subcommand:validate" help:"check the configuration without updating any records or making any requests"`
+}
+
+// ValidateCmd checks the configuration. It has no options of its own.
+type ValidateCmd struct{}
+
+// ParseArgs parses and returns command line args. If they are invalid, or the config command is
+// given without a subcommand, usage information is printed and the program exits.
+func ParseArgs() *Args {
+	return parseArgs(arg.Config{}, os.Args[1:])
 }
 
-// ParseArgs parses and returns command line args.
-func ParseArgs() (a *Args) {
-	a = &Args{}
-	arg.MustParse(a)
+// parseArgs parses cmdline, printing usage information to c.Out and calling c.Exit if it is invalid.
+func parseArgs(c arg.Config, cmdline []string) *Args {
+	a := &Args{}
+	p, err := arg.NewParser(c, a)
+	if err != nil {
+		// The args are fixed, so this can only be a mistake in their tags
+		panic(err)
+	}
+	p.MustParse(cmdline)
+	if a.Config != nil && a.Config.Validate == nil {
+		p.FailSubcommand("a config command is required", "config")
+	}
 	return a
 }
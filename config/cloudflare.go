@@ -0,0 +1,6 @@
+package config
+
+// Cloudflare specifies options pertaining to the Cloudflare API.
+type Cloudflare struct {
+	APIToken string `help:"Cloudflare API token with permission to edit DNS records, or a reference to it: env:NAME, file:PATH or cmd:COMMAND [env: CLOUDFLARE_API_TOKEN or CLOUDFLARE_API_TOKEN_FILE]"`
+}
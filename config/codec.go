@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// codec encodes and decodes config files in a particular format.
+type codec struct {
+	marshal   func(any) ([]byte, error)
+	unmarshal func([]byte, any) error
+}
+
+// YAML and TOML config files are converted to and from JSON, so that the keys of config files are
+// the same whatever their format, and are matched case insensitively.
+var (
+	jsonCodec = codec{marshal: json.Marshal, unmarshal: json.Unmarshal}
+	yamlCodec = codec{marshal: marshalViaJSON(yaml.Marshal), unmarshal: unmarshalViaJSON(yaml.Unmarshal)}
+	tomlCodec = codec{marshal: marshalViaJSON(marshalTOML), unmarshal: unmarshalViaJSON(toml.Unmarshal)}
+)
+
+// codecFor returns the codec for the config file at path, chosen by its extension: .yaml or .yml
+// for YAML, .toml for TOML, and JSON for any other extension.
+func codecFor(path string) codec {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yamlCodec
+	case ".toml":
+		return tomlCodec
+	}
+	return jsonCodec
+}
+
+// marshalViaJSON returns a function encoding values with marshal as they would be encoded as JSON.
+func marshalViaJSON(marshal func(any) ([]byte, error)) func(any) ([]byte, error) {
+	return func(v any) ([]byte, error) {
+		j, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		d := json.NewDecoder(bytes.NewReader(j))
+		d.UseNumber()
+		var m map[string]any
+		if err := d.Decode(&m); err != nil {
+			return nil, err
+		}
+		return marshal(convertNumbers(m))
+	}
+}
+
+// unmarshalViaJSON returns a function decoding data with unmarshal as if it were JSON.
+func unmarshalViaJSON(unmarshal func([]byte, any) error) func([]byte, any) error {
+	return func(data []byte, v any) error {
+		var m map[string]any
+		if err := unmarshal(data, &m); err != nil {
+			return err
+		}
+		j, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(j, v); err != nil {
+			// The position of JSON errors is meaningless in the original data.
+			return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+		}
+		return nil
+	}
+}
+
+// convertNumbers replaces every json.Number in v with an int64, or a float64 if it is not an
+// integer, so that integers are not written as floats.
+func convertNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, e := range v {
+			v[k] = convertNumbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = convertNumbers(e)
+		}
+	}
+	return v
+}
+
+func marshalTOML(v any) ([]byte, error) {
+	var b bytes.Buffer
+	if err := toml.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// positionError adds the line and column at which err occurred to err, if known. YAML errors
+// already give the line.
+func positionError(data []byte, err error) error {
+	var offset int64
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	var pe toml.ParseError
+	switch {
+	case errors.As(err, &se):
+		offset = se.Offset
+	case errors.As(err, &te):
+		offset = te.Offset
+	case errors.As(err, &pe):
+		offset = int64(pe.Position.Start) + 1
+	default:
+		return err
+	}
+	before := data[:min(int(offset), len(data))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := max(len(before)-bytes.LastIndexByte(before, '\n')-1, 1)
+	return fmt.Errorf("line %d, column %d: %w", line, col, err)
+}
@@ -0,0 +1,14 @@
+package config
+
+// DefaultIPSource is the source used to detect the current IP address if none are configured.
+const DefaultIPSource = "ipify"
+
+// Detection specifies options pertaining to detecting the current IP address.
+type Detection struct {
+	IPv4Sources []string `arg:"--ipv4-source,separate" help:"source of the current IPv4 address: ipify, icanhazip, ifconfig.me, a URL returning the address as plain text, interface:<name> to use an address of a local network interface, or upnp[:<gateway>] to ask the router using UPnP IGD or NAT-PMP; may be repeated to fall back on failure (default: ipify)"`
+	IPv6Sources []string `arg:"--ipv6-source,separate" help:"source of the current IPv6 address, as for --ipv4-source except for ifconfig.me and upnp (default: ipify)"`
+	Quorum      int      `arg:"--ip-quorum" help:"number of sources which must agree on an address before it is trusted (default: 1)"`
+	// AllowPrivate accepts addresses from web services, network interfaces and the router which
+	// cannot be public, e.g. for lab setups.
+	AllowPrivate bool `arg:"--allow-private-ip" help:"accept private, CGNAT and documentation addresses from any source, and loopback and link-local addresses from web services and the router"`
+}
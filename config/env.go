@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	scalar "github.com/alexflint/go-scalar"
+)
+
+// EnvPrefix is the prefix of the environment variables from which options can be set. The variable
+// for each option is named after its command line flag, e.g. DDCLIENT_DOMAIN for --domain or
+// DDCLIENT_HTTP_TIMEOUT for --http-timeout. Options which may be repeated, such as
+// --ipv4-source, are given as a comma separated list.
+const EnvPrefix = "DDCLIENT_"
+
+// argsFromEnv returns the options set by environment variables, looked up with lookup, as though
+// they had been given as args. Fields of Args tagged env:"-", which select what is done rather than
+// configure it, cannot be set from the environment.
+func argsFromEnv(lookup func(string) (string, bool)) (*Args, error) {
+	a := &Args{}
+	var e []string
+	setFromEnv(reflect.ValueOf(a).Elem(), lookup, &e)
+	if e != nil {
+		return nil, fmt.Errorf("Invalid environment: %s", strings.Join(e, ", "))
+	}
+	return a, nil
+}
+
+// setFromEnv sets each field of the struct v, and of structs embedded in it, from its environment
+// variable. A description of each value which cannot be parsed is added to e.
+func setFromEnv(v reflect.Value, lookup func(string) (string, bool), e *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("env") == "-" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			setFromEnv(v.Field(i), lookup, e)
+			continue
+		}
+		flag, ok := flagName(f)
+		if !ok {
+			continue
+		}
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+		s, ok := lookup(name)
+		if !ok || s == "" {
+			continue
+		}
+		if err := parseEnv(v.Field(i), s); err != nil {
+			*e = append(*e, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+}
+
+// flagName returns the name of the command line flag for f, without the leading dashes, as chosen
+// by go-arg. It returns false if f is not set from the command line.
+func flagName(f reflect.StructField) (string, bool) {
+	for _, opt := range strings.Split(f.Tag.Get("arg"), ",") {
+		if opt == "-" {
+			return "", false
+		}
+		if name, ok := strings.CutPrefix(opt, "--"); ok {
+			return name, true
+		}
+	}
+	return strings.ToLower(f.Name), true
+}
+
+// parseEnv parses s into v. Lists are split on commas.
+func parseEnv(v reflect.Value, s string) error {
+	if v.Kind() != reflect.Slice {
+		return scalar.ParseValue(v, s)
+	}
+	items := strings.Split(s, ",")
+	l := reflect.MakeSlice(v.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := scalar.ParseValue(l.Index(i), strings.TrimSpace(item)); err != nil {
+			return err
+		}
+	}
+	v.Set(l)
+	return nil
+}
@@ -0,0 +1,7 @@
+package config
+
+// EncodeConfig exposes encodeConfig to tests in the config_test package.
+var EncodeConfig = encodeConfig
+
+// ParseArgsFrom exposes parseArgs to tests in the config_test package.
+var ParseArgsFrom = parseArgs
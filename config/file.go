@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// configFileMode is the mode of saved config files, which may contain credentials.
+const configFileMode = 0600
+
+// decodeConfig parses the contents of the config file at path into cfg, in the format given by the
+// extension of path. Porkbun credentials at the top level of the file, as written by earlier
+// versions, are still accepted. An empty file is an empty config. Errors give the line and column
+// at which the file could not be parsed.
+func decodeConfig(path string, data []byte, cfg *App) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	c := codecFor(path)
+	if err := c.unmarshal(data, cfg); err != nil {
+		return positionError(data, err)
+	}
+	if cfg.Porkbun == (Porkbun{}) {
+		c.unmarshal(data, &cfg.Porkbun)
+	}
+	return nil
+}
+
+// encodeConfig returns cfg encoded in the format given by the extension of path.
+func encodeConfig(path string, cfg *App) ([]byte, error) {
+	return codecFor(path).marshal(cfg)
+}
+
+// warnInsecurePermissions warns if the file at path can be accessed by users other than its owner,
+// as config files may contain credentials.
+func (s *service) warnInsecurePermissions(path string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		s.warn("Config file is accessible by other users - consider chmod 600", "file", path, "mode", fmt.Sprintf("%#o", perm))
+	}
+}
+
+// writeFileAtomic replaces the file at path with data, readable only by its owner. The data is
+// written to a temporary file which is then renamed, so that the file is never left partly written.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(configFileMode); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,22 @@
+package config
+
+import "time"
+
+const (
+	// DefaultHTTPTimeout bounds each HTTP request, including any retries, if no timeout is set.
+	DefaultHTTPTimeout = Duration(time.Minute)
+	// DefaultHTTPMaxAttempts is the number of attempts made for each HTTP request if none is set.
+	DefaultHTTPMaxAttempts = 4
+)
+
+// HTTP specifies options pertaining to the HTTP requests made to DNS providers and web services
+// detecting the IP address.
+type HTTP struct {
+	Timeout     Duration `arg:"--http-timeout" help:"how long to wait for each HTTP request, including retries (default: 1m)"`
+	MaxAttempts int      `arg:"--http-max-attempts" help:"how many times to attempt HTTP requests failing with transient errors (default: 4)"`
+	Proxy       string   `arg:"--http-proxy" help:"URL of the proxy to send HTTP requests through (default: from the HTTP_PROXY and HTTPS_PROXY environment variables)"`
+	CABundle    string   `arg:"--ca-bundle" help:"PEM file of CA certificates to trust in addition to the system certificates"`
+	// IPVersion forces HTTP connections over IPv4 or IPv6. As this also applies to web services
+	// detecting the IP address, only addresses of that family can then be detected from them.
+	IPVersion int `arg:"--http-ip-version" help:"make HTTP connections only over IPv4 (4) or IPv6 (6)"`
+}
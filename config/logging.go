@@ -0,0 +1,14 @@
+package config
+
+const (
+	// DefaultLogLevel is the minimum level of messages logged if no level is set.
+	DefaultLogLevel = "info"
+	// DefaultLogFormat is the format of logged messages if no format is set.
+	DefaultLogFormat = "text"
+)
+
+// Logging specifies options pertaining to the messages logged while running.
+type Logging struct {
+	Level  string `arg:"--log-level" help:"minimum level of messages to log: debug, info, warn or error (default: info)"`
+	Format string `arg:"--log-format" help:"format of logged messages: text or json (default: text)"`
+}
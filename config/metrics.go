@@ -0,0 +1,6 @@
+package config
+
+// Metrics specifies options pertaining to the Prometheus metrics served in daemon mode.
+type Metrics struct {
+	Address string `arg:"--metrics-address" help:"address on which to serve Prometheus metrics at /metrics when running as a daemon, e.g. :9108 (default: not served)"`
+}
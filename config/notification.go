@@ -0,0 +1,52 @@
+package config
+
+// Types of notification.
+const (
+	// NotifyWebhook posts each event as JSON to a URL.
+	NotifyWebhook = "webhook"
+	// NotifyNtfy publishes each event to an ntfy topic URL.
+	NotifyNtfy = "ntfy"
+	// NotifyGotify pushes each event to a Gotify server.
+	NotifyGotify = "gotify"
+	// NotifySMTP emails each event.
+	NotifySMTP = "smtp"
+	// NotifyCommand runs a shell command for each event.
+	NotifyCommand = "command"
+)
+
+// Events which can be notified.
+const (
+	// EventChanged is sent when the IP address held by a record is changed.
+	EventChanged = "changed"
+	// EventCreated is sent when a record is created.
+	EventCreated = "created"
+	// EventFailed is sent when a record could not be updated.
+	EventFailed = "failed"
+)
+
+// Notification specifies where and when events are notified. Notifications can only be set from a
+// config file.
+type Notification struct {
+	// Type is one of webhook, ntfy, gotify, smtp or command.
+	Type string
+	// Events lists the events to notify. If empty, every event is notified.
+	Events []string `json:",omitempty"`
+	// FailAfter is the number of consecutive failed updates of a record after which a failed event
+	// is sent. It is only sent once until the record is updated successfully again. Defaults to 1.
+	// Unless running as a daemon, failures are only counted across runs if a state file is set.
+	FailAfter int `json:",omitempty"`
+	// URL is the webhook URL, the ntfy topic URL or the Gotify server URL.
+	URL string `json:",omitempty"`
+	// Token is the Gotify application token, or the ntfy access token if the topic requires one.
+	// Like SMTPPassword, it can be given as a reference to a secret.
+	Token string `json:",omitempty"`
+	// SMTPServer is the host and port of the mail server, e.g. "smtp.example.com:587".
+	SMTPServer   string   `json:",omitempty"`
+	SMTPUsername string   `json:",omitempty"`
+	SMTPPassword string   `json:",omitempty"`
+	From         string   `json:",omitempty"`
+	To           []string `json:",omitempty"`
+	// Command is run with sh -c. Details of the event are passed in DDCLIENT_* environment
+	// variables.
+	Command string `json:",omitempty"`
+}
@@ -2,6 +2,6 @@ package config
 
 // Porkbun specifies options pertaining to the Porkbun API.
 type Porkbun struct {
-	APIKey    string `help:"Porkbun API key"`
-	SecretKey string `help:"Porkbun secret key"`
+	APIKey    string `help:"Porkbun API key, or a reference to it: env:NAME, file:PATH or cmd:COMMAND [env: PORKBUN_API_KEY or PORKBUN_API_KEY_FILE]"`
+	SecretKey string `help:"Porkbun secret key, or a reference to it: env:NAME, file:PATH or cmd:COMMAND [env: PORKBUN_SECRET_KEY or PORKBUN_SECRET_KEY_FILE]"`
 }
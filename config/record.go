@@ -1,8 +1,42 @@
 package config
 
+// Policies for handling multiple existing records with the same name and type.
+const (
+	// MultipleRecordsError refuses to update the records.
+	MultipleRecordsError = "error"
+	// MultipleRecordsUpdateAll updates every record with the current IP address.
+	MultipleRecordsUpdateAll = "update-all"
+	// MultipleRecordsDedupe updates one record and deletes the others.
+	MultipleRecordsDedupe = "dedupe"
+	// MultipleRecordsMatch updates only the record with the configured record ID or, if none is
+	// configured, the record with the configured notes.
+	MultipleRecordsMatch = "match"
+)
+
 // Record specifies configurable options pertaining to the DNS record with which we will interact with.
 type Record struct {
-	Domain string `help:"the domain of the record"`
-	Type   string `help:"the type of the record"`
-	Name   string `help:"the name of the record"`
+	Domain   string `help:"the domain of the record"`
+	Type     string `help:"the type of the record"`
+	Name     string `help:"the name of the record"`
+	TTL      int    `help:"the TTL of the record in seconds (default: provider default)"`
+	Notes    string `help:"notes to attach to the record"`
+	Provider string `help:"the DNS provider hosting the record (default: porkbun)"`
+	// MultipleRecords is the policy used when more than one record with the same name and type
+	// exists. RFC 2136 records always replace every existing record.
+	MultipleRecords string `arg:"--multiple-records" help:"how to handle multiple existing records: error, update-all, dedupe or match (default: error)"`
+	RecordID        string `arg:"--record-id" help:"the provider ID of the record to update when --multiple-records is match"`
+	// Porkbun optionally overrides the application wide Porkbun credentials for this record.
+	Porkbun *Porkbun `arg:"-" json:",omitempty"`
+	// Cloudflare optionally overrides the application wide Cloudflare credentials for this record.
+	Cloudflare *Cloudflare `arg:"-" json:",omitempty"`
+	// RFC2136 optionally overrides the application wide RFC 2136 settings for this record.
+	RFC2136 *RFC2136 `arg:"-" json:",omitempty"`
+}
+
+// FQDN returns the fully qualified domain name of the record, e.g. "www.example.com".
+func (r Record) FQDN() string {
+	if r.Name == "" {
+		return r.Domain
+	}
+	return r.Name + "." + r.Domain
 }
@@ -0,0 +1,10 @@
+package config
+
+// RFC2136 specifies options pertaining to sending RFC 2136 dynamic updates directly to a DNS server.
+type RFC2136 struct {
+	Server        string `arg:"--rfc2136-server" help:"address of the DNS server accepting dynamic updates, e.g. ns1.example.com:53"`
+	Zone          string `arg:"--rfc2136-zone" help:"zone to update (default: the domain of the record)"`
+	TSIGKeyName   string `arg:"--tsig-key-name" help:"name of the TSIG key used to sign updates"`
+	TSIGAlgorithm string `arg:"--tsig-algorithm" help:"algorithm of the TSIG key (default: hmac-sha256)"`
+	TSIGSecret    string `arg:"--tsig-secret" help:"base64 encoded secret of the TSIG key, or a reference to it: env:NAME, file:PATH or cmd:COMMAND [env: TSIG_SECRET or TSIG_SECRET_FILE]"`
+}
@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+// DefaultInterval is how often the IP address is checked in daemon mode if no interval is set.
+const DefaultInterval = Duration(5 * time.Minute)
+
+// Schedule specifies options pertaining to when the IP address is checked.
+type Schedule struct {
+	Interval   Duration `help:"how often to check the IP address when running as a daemon (default: 5m)"`
+	RunTimeout Duration `arg:"--run-timeout" help:"abort a check of the IP address and records if it takes longer than this (default: no limit)"`
+}
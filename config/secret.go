@@ -0,0 +1,135 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Secrets, such as API keys, can be given either directly or as a reference to where they are kept,
+// so that they need not be passed on the command line or saved in the config file:
+//
+//	env:NAME     the value of the environment variable NAME
+//	file:PATH    the contents of the file at PATH, e.g. a Docker or Kubernetes secret
+//	cmd:COMMAND  the output of COMMAND run with sh -c, e.g. "cmd:pass show porkbun/apikey"
+//
+// Whitespace surrounding the contents of files and the output of commands is ignored.
+const (
+	secretEnvPrefix  = "env:"
+	secretFilePrefix = "file:"
+	secretCmdPrefix  = "cmd:"
+)
+
+// resolveSecret returns the secret referred to by s, or s itself if it is not a reference.
+func resolveSecret(s string) (string, error) {
+	if name, ok := strings.CutPrefix(s, secretEnvPrefix); ok {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		return v, nil
+	}
+	if path, ok := strings.CutPrefix(s, secretFilePrefix); ok {
+		d, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(d)), nil
+	}
+	if cmd, ok := strings.CutPrefix(s, secretCmdPrefix); ok {
+		out, err := exec.Command("sh", "-c", cmd).Output()
+		if err != nil {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) && len(ee.Stderr) > 0 {
+				return "", fmt.Errorf("command failed: %w; %s", err, strings.TrimSpace(string(ee.Stderr)))
+			}
+			return "", fmt.Errorf("command failed: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return s, nil
+}
+
+// isSecretRef reports whether s is a reference to a secret rather than the secret itself.
+func isSecretRef(s string) bool {
+	return strings.HasPrefix(s, secretEnvPrefix) || strings.HasPrefix(s, secretFilePrefix) || strings.HasPrefix(s, secretCmdPrefix)
+}
+
+// checkSecretRef returns an error if the reference s is malformed. The secret is not resolved, so no
+// files are read and no commands are run.
+func checkSecretRef(s string) error {
+	if name, ok := strings.CutPrefix(s, secretEnvPrefix); ok {
+		if name == "" || strings.ContainsAny(name, "= \t\n") {
+			return fmt.Errorf("reference %q is not a valid environment variable name", s)
+		}
+		return nil
+	}
+	for _, prefix := range []string{secretFilePrefix, secretCmdPrefix} {
+		if v, ok := strings.CutPrefix(s, prefix); ok && strings.TrimSpace(v) == "" {
+			return fmt.Errorf("reference %q is empty", s)
+		}
+	}
+	return nil
+}
+
+// applySecretEnv sets the application wide secrets to references to the environment variables
+// PORKBUN_API_KEY, PORKBUN_SECRET_KEY, CLOUDFLARE_API_TOKEN and TSIG_SECRET, or to the files named
+// by the same variables suffixed with _FILE, where these have been set.
+func applySecretEnv(cfg *App) {
+	envSecret("PORKBUN_API_KEY", &cfg.Porkbun.APIKey)
+	envSecret("PORKBUN_SECRET_KEY", &cfg.Porkbun.SecretKey)
+	envSecret("CLOUDFLARE_API_TOKEN", &cfg.Cloudflare.APIToken)
+	envSecret("TSIG_SECRET", &cfg.RFC2136.TSIGSecret)
+}
+
+// envSecret sets dst to a reference to the environment variable name if it is set, or otherwise
+// to the file named by name_FILE if that is set.
+func envSecret(name string, dst *string) {
+	if _, ok := os.LookupEnv(name); ok {
+		*dst = secretEnvPrefix + name
+	} else if path := os.Getenv(name + "_FILE"); path != "" {
+		*dst = secretFilePrefix + path
+	}
+}
+
+// resolveSecrets replaces every secret in cfg which is a reference with the secret it refers to.
+func resolveSecrets(cfg *App) error {
+	var e []string
+	resolve := func(name string, s *string) {
+		v, err := resolveSecret(*s)
+		if err != nil {
+			e = append(e, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*s = v
+	}
+	resolveCreds := func(prefix string, p *Porkbun, c *Cloudflare, u *RFC2136) {
+		if p != nil {
+			resolve(prefix+"apikey", &p.APIKey)
+			resolve(prefix+"secretkey", &p.SecretKey)
+		}
+		if c != nil {
+			resolve(prefix+"apitoken", &c.APIToken)
+		}
+		if u != nil {
+			resolve(prefix+"tsig-secret", &u.TSIGSecret)
+		}
+	}
+
+	resolveCreds("", &cfg.Porkbun, &cfg.Cloudflare, &cfg.RFC2136)
+	for i := range cfg.Records {
+		r := &cfg.Records[i]
+		resolveCreds(fmt.Sprintf("records[%d].", i), r.Porkbun, r.Cloudflare, r.RFC2136)
+	}
+	for i := range cfg.Notifications {
+		n := &cfg.Notifications[i]
+		resolve(fmt.Sprintf("notifications[%d].token", i), &n.Token)
+		resolve(fmt.Sprintf("notifications[%d].smtppassword", i), &n.SMTPPassword)
+	}
+	if e != nil {
+		return fmt.Errorf("Failed to resolve secrets: %s", strings.Join(e, ", "))
+	}
+	return nil
+}
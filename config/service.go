@@ -1,7 +1,6 @@
 package config
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -15,13 +14,42 @@ type Service interface {
 	// Returns an error if the config file path has been specified,
 	// but cannot be read.
 	BuildConfig() (*App, error)
+	// ValidateConfig returns a config.App built as by BuildConfig, except that secrets given as
+	// references are only checked for syntax rather than resolved, so that no secret commands are
+	// run. Validation problems are returned as a *ValidationError.
+	ValidateConfig() (*App, error)
 	// SaveConfig persists config.App.
 	// Returns an error if no config file path has been specified.
 	SaveConfig() error
+	// ConfigFilePath returns the path of the config file given by args or, failing that, by the
+	// DDCLIENT_CONFIG environment variable. It is empty if neither is set.
+	ConfigFilePath() string
+	// Warnings returns the problems found by the last call to BuildConfig, ValidateConfig or
+	// SaveConfig which did not stop the config being used. They are left to the caller to report,
+	// as the logger is not set up until the config has been built.
+	Warnings() []Warning
+}
+
+// Warning is a problem with the configuration which does not stop it being used. Args are
+// alternating keys and values, as passed to slog.
+type Warning struct {
+	Msg  string
+	Args []any
+}
+
+// String returns the message followed by each key and value.
+func (w Warning) String() string {
+	var b strings.Builder
+	b.WriteString(w.Msg)
+	for i := 0; i+1 < len(w.Args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", w.Args[i], w.Args[i+1])
+	}
+	return b.String()
 }
 
 type service struct {
-	args *Args
+	args     *Args
+	warnings []Warning
 }
 
 // NewService returns a service for handling application configuration.
@@ -30,91 +58,264 @@ func NewService(a *Args) Service {
 }
 
 func (s *service) BuildConfig() (*App, error) {
+	return s.buildConfig(true)
+}
+
+func (s *service) ValidateConfig() (*App, error) {
+	return s.buildConfig(false)
+}
+
+// buildConfig builds and validates the config, resolving secret references if resolve is set.
+func (s *service) buildConfig(resolve bool) (*App, error) {
+	s.warnings = nil
+	env, err := argsFromEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	path := s.ConfigFilePath()
+
 	cfg := &App{}
-	if s.args.ConfigFilePath != "" {
-		data, err := ioutil.ReadFile(s.args.ConfigFilePath)
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			return nil, err
 		}
-		json.Unmarshal(data, cfg)
+		s.warnInsecurePermissions(path)
+		if err := decodeConfig(path, data, cfg); err != nil {
+			return nil, fmt.Errorf("Failed to parse config file %s: %w", path, err)
+		}
 	}
 
-	if s.args.Domain != "" {
-		cfg.Domain = s.args.Domain
+	// Options set in the environment override the config file, and args override both
+	applySecretEnv(cfg)
+	mergeArgs(cfg, env)
+	mergeArgs(cfg, s.args)
+	applyDefaults(cfg)
+
+	if resolve {
+		if err := resolveSecrets(cfg); err != nil {
+			return nil, err
+		}
 	}
-	if s.args.Type != "" {
-		cfg.Type = s.args.Type
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
 	}
-	if s.args.Name != "" {
-		cfg.Name = s.args.Name
+	return cfg, nil
+}
+
+// mergeArgs overwrites the settings in cfg with any which have been set in a.
+func mergeArgs(cfg *App, a *Args) {
+	if a.Domain != "" {
+		cfg.Domain = a.Domain
 	}
-	if s.args.APIKey != "" {
-		cfg.APIKey = s.args.APIKey
+	if a.Type != "" {
+		cfg.Type = a.Type
 	}
-	if s.args.SecretKey != "" {
-		cfg.SecretKey = s.args.SecretKey
+	if a.Name != "" {
+		cfg.Name = a.Name
 	}
-	if err := s.validateConfig(cfg); err != nil {
-		return nil, err
+	if a.TTL != 0 {
+		cfg.TTL = a.TTL
+	}
+	if a.Notes != "" {
+		cfg.Notes = a.Notes
+	}
+	if a.Provider != "" {
+		cfg.Provider = a.Provider
+	}
+	if a.MultipleRecords != "" {
+		cfg.MultipleRecords = a.MultipleRecords
+	}
+	if a.RecordID != "" {
+		cfg.RecordID = a.RecordID
+	}
+	if a.APIKey != "" {
+		cfg.Porkbun.APIKey = a.APIKey
+	}
+	if a.SecretKey != "" {
+		cfg.Porkbun.SecretKey = a.SecretKey
+	}
+	if a.APIToken != "" {
+		cfg.Cloudflare.APIToken = a.APIToken
+	}
+	mergeRFC2136(&cfg.RFC2136, a.RFC2136)
+	if a.Interval != 0 {
+		cfg.Interval = a.Interval
+	}
+	if a.RunTimeout != 0 {
+		cfg.RunTimeout = a.RunTimeout
+	}
+	if a.StateFile != "" {
+		cfg.StateFile = a.StateFile
+	}
+	if a.VerifyInterval != 0 {
+		cfg.VerifyInterval = a.VerifyInterval
+	}
+	mergeDetection(&cfg.Detection, a.Detection)
+	mergeHTTP(&cfg.HTTP, a.HTTP)
+	mergeLogging(&cfg.Logging, a.Logging)
+	if a.Metrics.Address != "" {
+		cfg.Metrics.Address = a.Metrics.Address
+	}
+}
+
+// applyDefaults sets every setting in cfg which has a default and has not been set.
+func applyDefaults(cfg *App) {
+	if cfg.Interval == 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.VerifyInterval == 0 {
+		cfg.VerifyInterval = DefaultVerifyInterval
+	}
+	if cfg.Detection.IPv4Sources == nil {
+		cfg.Detection.IPv4Sources = []string{DefaultIPSource}
+	}
+	if cfg.Detection.IPv6Sources == nil {
+		cfg.Detection.IPv6Sources = []string{DefaultIPSource}
+	}
+	if cfg.Detection.Quorum == 0 {
+		cfg.Detection.Quorum = 1
+	}
+	if cfg.HTTP.Timeout == 0 {
+		cfg.HTTP.Timeout = DefaultHTTPTimeout
+	}
+	if cfg.HTTP.MaxAttempts == 0 {
+		cfg.HTTP.MaxAttempts = DefaultHTTPMaxAttempts
+	}
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = DefaultLogLevel
+	}
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = DefaultLogFormat
+	}
+	for i := range cfg.Notifications {
+		if cfg.Notifications[i].FailAfter == 0 {
+			cfg.Notifications[i].FailAfter = 1
+		}
+	}
+}
+
+// warnPlaintextSecrets warns of any secrets given directly in a, rather than as references, as
+// these are saved as they are.
+func (s *service) warnPlaintextSecrets(a *Args) {
+	for name, v := range map[string]string{
+		"apikey":      a.APIKey,
+		"secretkey":   a.SecretKey,
+		"apitoken":    a.APIToken,
+		"tsig-secret": a.TSIGSecret,
+	} {
+		if v != "" && !isSecretRef(v) {
+			s.warn("Saving secret in plain text - consider an env:, file: or cmd: reference", "option", name)
+		}
 	}
-	return cfg, nil
 }
 
-func (s *service) validateConfig(cfg *App) error {
-	var e []string
-	if cfg.Domain == "" {
-		e = append(e, "domain not set")
+// mergeRFC2136 overwrites the settings in dst with any which have been set in src.
+func mergeRFC2136(dst *RFC2136, src RFC2136) {
+	if src.Server != "" {
+		dst.Server = src.Server
 	}
-	if cfg.Type == "" {
-		e = append(e, "type not set")
+	if src.Zone != "" {
+		dst.Zone = src.Zone
 	}
-	if cfg.Name == "" {
-		fmt.Println("Name not set - modifying root domain record")
+	if src.TSIGKeyName != "" {
+		dst.TSIGKeyName = src.TSIGKeyName
 	}
-	if cfg.APIKey == "" {
-		e = append(e, "apikey not set")
+	if src.TSIGAlgorithm != "" {
+		dst.TSIGAlgorithm = src.TSIGAlgorithm
 	}
-	if cfg.SecretKey == "" {
-		e = append(e, "secretkey not set")
+	if src.TSIGSecret != "" {
+		dst.TSIGSecret = src.TSIGSecret
+	}
+}
+
+// mergeHTTP overwrites the settings in dst with any which have been set in src.
+func mergeHTTP(dst *HTTP, src HTTP) {
+	if src.Timeout != 0 {
+		dst.Timeout = src.Timeout
+	}
+	if src.MaxAttempts != 0 {
+		dst.MaxAttempts = src.MaxAttempts
+	}
+	if src.Proxy != "" {
+		dst.Proxy = src.Proxy
+	}
+	if src.CABundle != "" {
+		dst.CABundle = src.CABundle
+	}
+	if src.IPVersion != 0 {
+		dst.IPVersion = src.IPVersion
+	}
+}
+
+// mergeLogging overwrites the settings in dst with any which have been set in src.
+func mergeLogging(dst *Logging, src Logging) {
+	if src.Level != "" {
+		dst.Level = src.Level
 	}
-	if e != nil {
-		return fmt.Errorf("Validation failed: %s", strings.Join(e, ", "))
+	if src.Format != "" {
+		dst.Format = src.Format
+	}
+}
+
+// mergeDetection overwrites the settings in dst with any which have been set in src.
+func mergeDetection(dst *Detection, src Detection) {
+	if src.IPv4Sources != nil {
+		dst.IPv4Sources = src.IPv4Sources
+	}
+	if src.IPv6Sources != nil {
+		dst.IPv6Sources = src.IPv6Sources
+	}
+	if src.Quorum != 0 {
+		dst.Quorum = src.Quorum
+	}
+	if src.AllowPrivate {
+		dst.AllowPrivate = true
 	}
-	return nil
 }
 
 func (s *service) SaveConfig() error {
-	if s.args.ConfigFilePath == "" {
+	s.warnings = nil
+	path := s.ConfigFilePath()
+	if path == "" {
 		return errors.New("No config filename specified")
 	}
 
 	// Read existing config (ignore file not found)
-	data, err := ioutil.ReadFile(s.args.ConfigFilePath)
+	data, err := ioutil.ReadFile(path)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	savedCfg := App{}
-	json.Unmarshal(data, &savedCfg)
+	if err := decodeConfig(path, data, &savedCfg); err != nil {
+		return fmt.Errorf("Failed to parse config file %s: %w", path, err)
+	}
 
 	// Add any given options
-	if s.args.Domain != "" {
-		savedCfg.Domain = s.args.Domain
-	}
-	if s.args.Type != "" {
-		savedCfg.Type = s.args.Type
-	}
-	if s.args.Name != "" {
-		savedCfg.Name = s.args.Name
-	}
-	if s.args.APIKey != "" {
-		savedCfg.APIKey = s.args.APIKey
+	applySecretEnv(&savedCfg)
+	s.warnPlaintextSecrets(s.args)
+	mergeArgs(&savedCfg, s.args)
+
+	// Save the updated configs
+	d, err := encodeConfig(path, &savedCfg)
+	if err != nil {
+		return err
 	}
-	if s.args.SecretKey != "" {
-		savedCfg.SecretKey = s.args.SecretKey
+	return writeFileAtomic(path, d)
+}
+
+func (s *service) ConfigFilePath() string {
+	if s.args.ConfigFilePath != "" {
+		return s.args.ConfigFilePath
 	}
+	return os.Getenv(EnvPrefix + "CONFIG")
+}
 
-	// Save the updated configs
-	d, _ := json.Marshal(savedCfg)
-	ioutil.WriteFile(s.args.ConfigFilePath, d, 0644)
-	return nil
+func (s *service) Warnings() []Warning {
+	return s.warnings
+}
+
+// warn records a warning to be returned by Warnings.
+func (s *service) warn(msg string, args ...any) {
+	s.warnings = append(s.warnings, Warning{Msg: msg, Args: args})
 }
@@ -1,13 +1,18 @@
 package config_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/alexflint/go-arg"
 	. "github.com/bhorvath/ddclient/config"
 	"github.com/bhorvath/ddclient/mock"
 )
@@ -72,6 +77,25 @@ func TestSavesConfigFile(t *testing.T) {
 			APIKey:			"api-key",
 			SecretKey:	"secret-key",
 		},
+		Schedule: Schedule{
+			Interval: DefaultInterval,
+		},
+		State: State{
+			VerifyInterval: DefaultVerifyInterval,
+		},
+		Detection: Detection{
+			IPv4Sources: []string{DefaultIPSource},
+			IPv6Sources: []string{DefaultIPSource},
+			Quorum:      1,
+		},
+		HTTP: HTTP{
+			Timeout:     DefaultHTTPTimeout,
+			MaxAttempts: DefaultHTTPMaxAttempts,
+		},
+		Logging: Logging{
+			Level:  DefaultLogLevel,
+			Format: DefaultLogFormat,
+		},
 	}
 
 	a := Args{Record: want.Record, Porkbun: want.Porkbun}
@@ -130,6 +154,753 @@ func TestValidatesConfigReturnsErrorIfInvalid(t *testing.T) {
 	}
 }
 
+// Expect records listed in the config file to be returned alongside the top level record, with
+// records inheriting the application credentials unless they specify their own.
+func TestBuildsConfigsWithMultipleRecords(t *testing.T) {
+	own := &Porkbun{APIKey: "own-api-key", SecretKey: "own-secret-key"}
+	testCfg := mock.GetAppConfig()
+	testCfg.Records = []Record{
+		{Domain: "other.com", Type: "AAAA", TTL: 600},
+		{Domain: "another.com", Name: "www", Type: "A", Porkbun: own},
+	}
+	d, _ := json.Marshal(testCfg)
+	ioutil.WriteFile(configFilename, d, 0644)
+	defer func() { os.Remove(configFilename) }()
+
+	a := &Args{ConfigFilePath: configFilename}
+	builtCfg, err := NewService(a).BuildConfig()
+	if err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+
+	records := builtCfg.AllRecords()
+	if len(records) != 3 {
+		t.Fatalf("Got records: %v; want: 3", len(records))
+	}
+	if records[0].FQDN() != "test.internet.com" {
+		t.Errorf("Got first record: %v; want: test.internet.com", records[0].FQDN())
+	}
+	if got := builtCfg.PorkbunFor(records[1]); got != testCfg.Porkbun {
+		t.Errorf("Expected: %v; got: %v", testCfg.Porkbun, got)
+	}
+	if got := builtCfg.PorkbunFor(records[2]); got != *own {
+		t.Errorf("Expected: %v; got: %v", *own, got)
+	}
+}
+
+// Expect each listed record to be validated, identifying the record at fault.
+func TestValidatesEachRecord(t *testing.T) {
+	testCfg := App{Records: []Record{
+		{Domain: "other.com", Type: "A", Porkbun: &Porkbun{APIKey: "api-key", SecretKey: "secret-key"}},
+		{Domain: "another.com"},
+	}}
+	d, _ := json.Marshal(testCfg)
+	ioutil.WriteFile(configFilename, d, 0644)
+	defer func() { os.Remove(configFilename) }()
+
+	a := &Args{ConfigFilePath: configFilename}
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, "records[1].type not set") {
+		t.Errorf("Expected records[1] validation error; got: %v", err)
+	}
+	if ErrorContains(err, "records[0].") {
+		t.Errorf("Got unexpected records[0] validation error: %v", err)
+	}
+}
+
+// Expect Porkbun credentials at the top level of the config file, as written by earlier versions,
+// to still be read.
+func TestBuildsConfigsFromLegacyFile(t *testing.T) {
+	d := []byte(`{"Domain":"internet.com","Name":"test","Type":"A","APIKey":"api-key","SecretKey":"secret-key"}`)
+	ioutil.WriteFile(configFilename, d, 0644)
+	defer func() { os.Remove(configFilename) }()
+
+	a := &Args{ConfigFilePath: configFilename}
+	builtCfg, err := NewService(a).BuildConfig()
+
+	if err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+	if want := mock.GetAppConfig().Porkbun; builtCfg.Porkbun != want {
+		t.Errorf("Expected: %v; got: %v", want, builtCfg.Porkbun)
+	}
+}
+
+// Expect records using a provider without built in settings to be accepted, as providers can be
+// registered with the dns package.
+func TestAcceptsOtherProviders(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.Provider = "other"
+	_, err := NewService(a).BuildConfig()
+
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Expect an error if records are to be matched without a record ID or notes to match them by.
+func TestValidatesMultipleRecordsMatch(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.MultipleRecords = MultipleRecordsMatch
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, "record-id or notes must be set to match records") {
+		t.Errorf("Expected multiple records validation error; got: %v", err)
+	}
+}
+
+// Expect an error if HTTP connections are forced over an unknown IP version.
+func TestValidatesHTTPIPVersion(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.IPVersion = 5
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, "http-ip-version must be 4 or 6") {
+		t.Errorf("Expected IP version validation error; got: %v", err)
+	}
+}
+
+// Expect an error if more sources are required to agree than have been configured.
+func TestValidatesQuorum(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.IPv4Sources = []string{"ipify"}
+	a.Quorum = 2
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, "ip-quorum exceeds the number of IP address sources") {
+		t.Errorf("Expected quorum validation error; got: %v", err)
+	}
+}
+
+// Expect the quorum to only apply to the sources of address families used by the records.
+func TestValidatesQuorumOnlyForUsedFamilies(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.IPv4Sources = []string{"ipify", "icanhazip"}
+	a.Quorum = 2
+	if _, err := NewService(a).BuildConfig(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	a.Type = "AAAA"
+	_, err := NewService(a).BuildConfig()
+	if !ErrorContains(err, "ip-quorum exceeds the number of IP address sources") {
+		t.Errorf("Expected quorum validation error; got: %v", err)
+	}
+}
+
+// Expect an error for unknown log levels and formats.
+func TestValidatesLogging(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.Logging = Logging{Level: "verbose", Format: "xml"}
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, `log-level "verbose" not supported`) {
+		t.Errorf("Expected log level validation error; got: %v", err)
+	}
+	if !ErrorContains(err, `log-format "xml" not supported`) {
+		t.Errorf("Expected log format validation error; got: %v", err)
+	}
+}
+
+// Expect an error if metrics are to be served on an address without a port.
+func TestValidatesMetricsAddress(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.Metrics.Address = "localhost"
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, "metrics-address must be a host and port") {
+		t.Errorf("Expected metrics address validation error; got: %v", err)
+	}
+}
+
+// Expect every problem to be returned as a *FieldError within a *ValidationError.
+func TestValidationErrorIsTyped(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.Type = ""
+	a.TTL = -1
+	_, err := NewService(a).BuildConfig()
+
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Expected *ValidationError; got: %v", err)
+	}
+	want := []FieldError{{Field: "type", Message: "not set"}, {Field: "ttl", Message: "must be positive"}}
+	if len(ve.Errors) != len(want) {
+		t.Fatalf("Got: %v; want: %v", ve.Errors, want)
+	}
+	for i := range want {
+		if *ve.Errors[i] != want[i] {
+			t.Errorf("Got: %v; want: %v", *ve.Errors[i], want[i])
+		}
+	}
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != "type" {
+		t.Errorf("Expected first *FieldError to be found; got: %v", fe)
+	}
+}
+
+// Expect an error for record types other than A and AAAA.
+func TestValidatesType(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.Type = "MX"
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, `type "MX" not supported`) {
+		t.Errorf("Expected type validation error; got: %v", err)
+	}
+}
+
+// Expect no priority flag, as none of the supported record types have a priority.
+func TestNoPriorityFlag(t *testing.T) {
+	var a Args
+	p, err := arg.NewParser(arg.Config{}, &a)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := p.Parse([]string{"--priority", "10"}); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Expect an error for domains and names which are not valid host names, allowing wildcards.
+func TestValidatesHostnames(t *testing.T) {
+	tests := []struct {
+		domain, name string
+		want         string
+	}{
+		{"internet.com", "*.dev", ""},
+		{"internet.com", "a-b.c1", ""},
+		{"internet", "test", "is not a valid domain name"},
+		{"inter_net.com", "test", "is not a valid domain name"},
+		{"internet..com", "test", "is not a valid domain name"},
+		{"internet.com", "-test", "is not a valid record name"},
+		{"internet.com", "test.*", "is not a valid record name"},
+		{"internet.com", strings.Repeat("a", 64), "is not a valid record name"},
+		{"internet.com", strings.Repeat("a.", 125) + "a", "longer than 253 characters"},
+	}
+	for _, tt := range tests {
+		a := mock.GetAppArgs()
+		a.Domain, a.Name = tt.domain, tt.name
+		_, err := NewService(a).BuildConfig()
+
+		if tt.want == "" && err != nil {
+			t.Errorf("%s.%s: Unexpected error: %v", tt.name, tt.domain, err)
+		}
+		if tt.want != "" && !ErrorContains(err, tt.want) {
+			t.Errorf("%s.%s: Expected %q; got: %v", tt.name, tt.domain, tt.want, err)
+		}
+	}
+}
+
+// Expect TTLs to be within the bounds accepted by each provider.
+func TestValidatesTTL(t *testing.T) {
+	tests := []struct {
+		provider string
+		ttl      int
+		valid    bool
+	}{
+		{"porkbun", 0, true},
+		{"porkbun", 600, true},
+		{"porkbun", 300, false},
+		{"cloudflare", 1, true},
+		{"cloudflare", 60, true},
+		{"cloudflare", 30, false},
+		{"cloudflare", 86401, false},
+		{"rfc2136", 30, true},
+		{"rfc2136", 1 << 31, false},
+	}
+	for _, tt := range tests {
+		a := mock.GetAppArgs()
+		a.Provider, a.TTL = tt.provider, tt.ttl
+		a.APIToken = "token"
+		a.Server, a.TSIGKeyName, a.TSIGSecret = "ns.internet.com", "ddclient.", "c2VjcmV0"
+		_, err := NewService(a).BuildConfig()
+
+		if got := ErrorContains(err, "ttl "); got == tt.valid {
+			t.Errorf("%s %d: Got error: %v; want valid: %v", tt.provider, tt.ttl, err, tt.valid)
+		}
+	}
+}
+
+// Expect an error for credentials which cannot be valid.
+func TestValidatesCredentials(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.APIKey, a.SecretKey = "sk1_abc", "pk1_def"
+	_, err := NewService(a).BuildConfig()
+	if !ErrorContains(err, "apikey starts with sk1_") || !ErrorContains(err, "secretkey starts with pk1_") {
+		t.Errorf("Expected swapped keys error; got: %v", err)
+	}
+
+	a = mock.GetAppArgs()
+	a.APIKey = "pk1_abc def"
+	_, err = NewService(a).BuildConfig()
+	if !ErrorContains(err, "apikey must not contain whitespace") {
+		t.Errorf("Expected whitespace error; got: %v", err)
+	}
+
+	a = mock.GetAppArgs()
+	a.Provider, a.APIToken = "cloudflare", "Bearer abc"
+	_, err = NewService(a).BuildConfig()
+	if !ErrorContains(err, "apitoken must only contain") {
+		t.Errorf("Expected API token error; got: %v", err)
+	}
+
+	a = mock.GetAppArgs()
+	a.Provider = "rfc2136"
+	a.Server, a.TSIGKeyName, a.TSIGSecret, a.TSIGAlgorithm = "ns.internet.com", "ddclient.", "not base64!", "hmac-md5"
+	_, err = NewService(a).BuildConfig()
+	if !ErrorContains(err, "tsig-secret must be base64 encoded") || !ErrorContains(err, `tsig-algorithm "hmac-md5" not supported`) {
+		t.Errorf("Expected TSIG errors; got: %v", err)
+	}
+}
+
+// Expect validation to check secret references for syntax without resolving them.
+func TestValidateConfigDoesNotResolveSecrets(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	a := mock.GetAppArgs()
+	a.APIKey = "cmd:touch " + marker
+	a.SecretKey = "env:"
+	_, err := NewService(a).ValidateConfig()
+
+	if !ErrorContains(err, `secretkey reference "env:" is not a valid environment variable name`) {
+		t.Errorf("Expected reference validation error; got: %v", err)
+	}
+	if ErrorContains(err, "apikey") {
+		t.Errorf("Expected command reference to be accepted; got: %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected secret command not to be run")
+	}
+}
+
+// Expect each notification to be validated, identifying the notification at fault.
+func TestValidatesNotifications(t *testing.T) {
+	testCfg := mock.GetAppConfig()
+	testCfg.Notifications = []Notification{
+		{Type: NotifyWebhook, URL: "https://example.com/hook", Events: []string{EventFailed}},
+		{Type: NotifyGotify, URL: "https://gotify.example.com", Events: []string{"renewed"}},
+	}
+	d, _ := json.Marshal(testCfg)
+	ioutil.WriteFile(configFilename, d, 0644)
+	defer func() { os.Remove(configFilename) }()
+
+	a := &Args{ConfigFilePath: configFilename}
+	_, err := NewService(a).BuildConfig()
+
+	for _, want := range []string{`notifications[1].event "renewed" not supported`, "notifications[1].token not set"} {
+		if !ErrorContains(err, want) {
+			t.Errorf("Expected %q validation error; got: %v", want, err)
+		}
+	}
+	if ErrorContains(err, "notifications[0].") {
+		t.Errorf("Got unexpected notifications[0] validation error: %v", err)
+	}
+}
+
+// Expect secrets given as references to be resolved from the environment, files and commands.
+func TestResolvesSecretReferences(t *testing.T) {
+	t.Setenv("TEST_API_KEY", "env-api-key")
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(secretFile, []byte("file-secret-key\n"), 0600)
+	a := mock.GetAppArgs()
+	a.APIKey = "env:TEST_API_KEY"
+	a.SecretKey = "file:" + secretFile
+	a.APIToken = "cmd:echo cmd-api-token"
+
+	builtCfg, err := NewService(a).BuildConfig()
+	if err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+
+	want := Porkbun{APIKey: "env-api-key", SecretKey: "file-secret-key"}
+	if builtCfg.Porkbun != want {
+		t.Errorf("Expected: %v; got: %v", want, builtCfg.Porkbun)
+	}
+	if builtCfg.Cloudflare.APIToken != "cmd-api-token" {
+		t.Errorf("Expected: cmd-api-token; got: %v", builtCfg.Cloudflare.APIToken)
+	}
+}
+
+// Expect secrets to be taken from the environment, or from files named in the environment, unless
+// given as args.
+func TestBuildsSecretsFromEnvironment(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(secretFile, []byte("file-secret-key"), 0600)
+	t.Setenv("PORKBUN_API_KEY", "env-api-key")
+	t.Setenv("PORKBUN_SECRET_KEY_FILE", secretFile)
+	t.Setenv("CLOUDFLARE_API_TOKEN", "env-api-token")
+	a := mock.GetAppArgs()
+	a.Porkbun = Porkbun{}
+	a.APIToken = "arg-api-token"
+
+	builtCfg, err := NewService(a).BuildConfig()
+	if err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+
+	want := Porkbun{APIKey: "env-api-key", SecretKey: "file-secret-key"}
+	if builtCfg.Porkbun != want {
+		t.Errorf("Expected: %v; got: %v", want, builtCfg.Porkbun)
+	}
+	if builtCfg.Cloudflare.APIToken != "arg-api-token" {
+		t.Errorf("Expected: arg-api-token; got: %v", builtCfg.Cloudflare.APIToken)
+	}
+}
+
+// Expect an error identifying secrets which cannot be resolved.
+func TestErrorIfSecretUnresolvable(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.APIKey = "env:TEST_UNSET_API_KEY"
+	a.SecretKey = "cmd:exit 1"
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, "apikey: environment variable TEST_UNSET_API_KEY not set") {
+		t.Errorf("Expected apikey error; got: %v", err)
+	}
+	if !ErrorContains(err, "secretkey: command failed") {
+		t.Errorf("Expected secretkey error; got: %v", err)
+	}
+}
+
+// Expect secrets taken from the environment to be saved as references rather than as the secrets.
+func TestSavesSecretReferences(t *testing.T) {
+	defer func() { os.Remove(configFilename) }()
+	t.Setenv("PORKBUN_API_KEY", "env-api-key")
+	a := mock.GetAppArgs()
+	a.Porkbun.APIKey = ""
+	a.ConfigFilePath = configFilename
+
+	if err := NewService(a).SaveConfig(); err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+	f, _ := ioutil.ReadFile(configFilename)
+	got := App{}
+	json.Unmarshal(f, &got)
+
+	if got.Porkbun.APIKey != "env:PORKBUN_API_KEY" {
+		t.Errorf("Expected: env:PORKBUN_API_KEY; got: %v", got.Porkbun.APIKey)
+	}
+	if strings.Contains(string(f), "env-api-key") {
+		t.Errorf("Expected secret not to be saved; got: %s", f)
+	}
+}
+
+// Expect the config file to be saved readable only by its owner, replacing the existing file.
+func TestSavesConfigFileSecurely(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ddclient.json")
+	ioutil.WriteFile(path, []byte("{}"), 0644)
+	a := mock.GetAppArgs()
+	a.ConfigFilePath = path
+
+	if err := NewService(a).SaveConfig(); err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("Got mode: %#o; want: 0600", perm)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the config file to remain; got: %v", entries)
+	}
+}
+
+// Expect an error giving the position at which a corrupt config file could not be parsed.
+func TestErrorIfConfigFileCorrupt(t *testing.T) {
+	ioutil.WriteFile(configFilename, []byte("{\n  \"Domain\": \"internet.com\",\n  oops\n}"), 0600)
+	defer func() { os.Remove(configFilename) }()
+
+	a := &Args{ConfigFilePath: configFilename}
+	_, err := NewService(a).BuildConfig()
+
+	if !ErrorContains(err, "line 3, column 3") {
+		t.Errorf("Expected parse error at line 3, column 3; got: %v", err)
+	}
+}
+
+// Expect a corrupt config file not to be overwritten when saving.
+func TestSaveErrorIfConfigFileCorrupt(t *testing.T) {
+	corrupt := []byte(`{"Domain": 1}`)
+	ioutil.WriteFile(configFilename, corrupt, 0600)
+	defer func() { os.Remove(configFilename) }()
+
+	a := mock.GetAppArgs()
+	a.ConfigFilePath = configFilename
+	err := NewService(a).SaveConfig()
+
+	if !ErrorContains(err, "line 1, column 12") {
+		t.Errorf("Expected parse error at line 1, column 12; got: %v", err)
+	}
+	if f, _ := ioutil.ReadFile(configFilename); string(f) != string(corrupt) {
+		t.Errorf("Expected config file to be unchanged; got: %s", f)
+	}
+}
+
+// Expect a warning if the config file can be read by other users.
+func TestWarnsIfConfigFileInsecure(t *testing.T) {
+	d, _ := json.Marshal(mock.GetAppConfig())
+	ioutil.WriteFile(configFilename, d, 0644)
+	os.Chmod(configFilename, 0644)
+	defer func() { os.Remove(configFilename) }()
+
+	a := &Args{ConfigFilePath: configFilename}
+	s := NewService(a)
+	if _, err := s.BuildConfig(); err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+
+	want := []Warning{{Msg: "Config file is accessible by other users - consider chmod 600", Args: []any{"file", configFilename, "mode", "0644"}}}
+	if got := s.Warnings(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected: %v; got: %v", want, got)
+	}
+}
+
+// Expect a warning for each secret saved in plain text, and none for secret references.
+func TestWarnsIfSavingPlaintextSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ddclient.json")
+	a := mock.GetAppArgs()
+	a.ConfigFilePath = path
+	a.SecretKey = "env:SECRET_KEY"
+	s := NewService(a)
+	if err := s.SaveConfig(); err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+
+	want := []Warning{{Msg: "Saving secret in plain text - consider an env:, file: or cmd: reference", Args: []any{"option", "apikey"}}}
+	if got := s.Warnings(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected: %v; got: %v", want, got)
+	}
+}
+
+// Expect configs to be saved and read back in the format given by the config file extension.
+func TestConfigFileFormatsRoundTrip(t *testing.T) {
+	for _, ext := range []string{".json", ".yaml", ".yml", ".toml"} {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ddclient"+ext)
+			want := mock.GetAppConfig()
+			want.Records = []Record{
+				{Domain: "other.com", Type: "AAAA", TTL: 600, Porkbun: &Porkbun{APIKey: "own-api-key", SecretKey: "own-secret-key"}},
+			}
+			want.Notifications = []Notification{
+				{Type: NotifyWebhook, URL: "https://example.com/hook", Events: []string{EventFailed}, FailAfter: 3},
+			}
+			d, err := EncodeConfig(path, want)
+			if err != nil {
+				t.Fatalf("Got error: %v", err.Error())
+			}
+			ioutil.WriteFile(path, d, 0600)
+
+			a := mock.GetAppArgs()
+			a.ConfigFilePath = path
+			a.Interval = Duration(time.Hour)
+			if err := NewService(a).SaveConfig(); err != nil {
+				t.Fatalf("Got error: %v", err.Error())
+			}
+			got, err := NewService(&Args{ConfigFilePath: path}).BuildConfig()
+			if err != nil {
+				t.Fatalf("Got error: %v", err.Error())
+			}
+
+			want.Interval = Duration(time.Hour)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("Expected: %v; got: %v", want, got)
+			}
+		})
+	}
+}
+
+// Expect YAML and TOML config files to be read, including comments.
+func TestBuildsConfigsFromYAMLAndTOML(t *testing.T) {
+	files := map[string]string{
+		"ddclient.yaml": `# Home IP address
+domain: internet.com
+name: test
+type: A
+porkbun:
+  apikey: api-key # not a real key
+  secretkey: secret-key
+`,
+		"ddclient.toml": `# Home IP address
+Domain = "internet.com"
+Name = "test"
+Type = "A"
+
+[Porkbun]
+APIKey = "api-key" # not a real key
+SecretKey = "secret-key"
+`,
+	}
+	for name, contents := range files {
+		path := filepath.Join(t.TempDir(), name)
+		ioutil.WriteFile(path, []byte(contents), 0600)
+
+		got, err := NewService(&Args{ConfigFilePath: path}).BuildConfig()
+		if err != nil {
+			t.Fatalf("%s: got error: %v", name, err.Error())
+		}
+		if want := mock.GetAppConfig(); !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: expected: %v; got: %v", name, want, got)
+		}
+	}
+}
+
+// Expect errors in YAML and TOML config files to give the line at which they occurred.
+func TestErrorIfYAMLOrTOMLConfigFileCorrupt(t *testing.T) {
+	files := map[string]string{
+		"ddclient.yaml": "domain: internet.com\nname: [test\n",
+		"ddclient.toml": "Domain = \"internet.com\"\nName = test\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(t.TempDir(), name)
+		ioutil.WriteFile(path, []byte(contents), 0600)
+
+		_, err := NewService(&Args{ConfigFilePath: path}).BuildConfig()
+		if !ErrorContains(err, "line ") {
+			t.Errorf("%s: expected parse error giving the line; got: %v", name, err)
+		}
+	}
+}
+
+// Expect options to be taken from defaults, then the config file, then the environment and then
+// args, with each overriding the last.
+func TestBuildsConfigsInPrecedenceOrder(t *testing.T) {
+	fileCfg := App{
+		Record:   Record{Domain: "internet.com", Name: "file", Type: "A", TTL: 300},
+		Porkbun:  Porkbun{APIKey: "api-key", SecretKey: "secret-key"},
+		Schedule: Schedule{Interval: Duration(time.Hour)},
+	}
+	d, _ := json.Marshal(fileCfg)
+	ioutil.WriteFile(configFilename, d, 0600)
+	defer func() { os.Remove(configFilename) }()
+	t.Setenv("DDCLIENT_CONFIG", configFilename)
+	t.Setenv("DDCLIENT_NAME", "env")
+	t.Setenv("DDCLIENT_TTL", "600")
+	t.Setenv("DDCLIENT_INTERVAL", "10m")
+	t.Setenv("DDCLIENT_HTTP_TIMEOUT", "30s")
+	t.Setenv("DDCLIENT_IPV4_SOURCE", "icanhazip, ipify")
+
+	a := &Args{}
+	a.TTL = 900
+	builtCfg, err := NewService(a).BuildConfig()
+	if err != nil {
+		t.Fatalf("Got error: %v", err.Error())
+	}
+
+	if builtCfg.Domain != "internet.com" {
+		t.Errorf("Expected domain from file: internet.com; got: %v", builtCfg.Domain)
+	}
+	if builtCfg.Name != "env" {
+		t.Errorf("Expected name from environment: env; got: %v", builtCfg.Name)
+	}
+	if builtCfg.TTL != 900 {
+		t.Errorf("Expected TTL from args: 900; got: %v", builtCfg.TTL)
+	}
+	if builtCfg.Interval != Duration(10*time.Minute) {
+		t.Errorf("Expected interval from environment: 10m; got: %v", builtCfg.Interval)
+	}
+	if builtCfg.HTTP.Timeout != Duration(30*time.Second) {
+		t.Errorf("Expected HTTP timeout from environment: 30s; got: %v", builtCfg.HTTP.Timeout)
+	}
+	if want := []string{"icanhazip", "ipify"}; !reflect.DeepEqual(builtCfg.Detection.IPv4Sources, want) {
+		t.Errorf("Expected IPv4 sources from environment: %v; got: %v", want, builtCfg.Detection.IPv4Sources)
+	}
+	if builtCfg.VerifyInterval != DefaultVerifyInterval {
+		t.Errorf("Expected default verify interval: %v; got: %v", DefaultVerifyInterval, builtCfg.VerifyInterval)
+	}
+}
+
+// Expect configs to be saved to the file named by DDCLIENT_CONFIG if no file is given by args.
+func TestSavesConfigToFileFromEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ddclient.json")
+	t.Setenv("DDCLIENT_CONFIG", path)
+	a := mock.GetAppArgs()
+	a.ConfigFilePath = ""
+	s := NewService(a)
+
+	if s.ConfigFilePath() != path {
+		t.Errorf("Got config file path: %v; want: %v", s.ConfigFilePath(), path)
+	}
+	if err := s.SaveConfig(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	builtCfg, err := NewService(&Args{}).BuildConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if builtCfg.Domain != a.Domain {
+		t.Errorf("Expected domain from saved file: %v; got: %v", a.Domain, builtCfg.Domain)
+	}
+}
+
+// Expect an error identifying environment variables which cannot be parsed.
+func TestErrorIfEnvironmentInvalid(t *testing.T) {
+	t.Setenv("DDCLIENT_INTERVAL", "often")
+	_, err := NewService(mock.GetAppArgs()).BuildConfig()
+
+	if !ErrorContains(err, "DDCLIENT_INTERVAL") {
+		t.Errorf("Expected environment error; got: %v", err)
+	}
+}
+
+// Expect the flags selecting what is done to be parsed.
+func TestParsesActionFlags(t *testing.T) {
+	var a Args
+	p, err := arg.NewParser(arg.Config{}, &a)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := p.Parse([]string{"--dry-run", "--save"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !a.DryRun || !a.Save {
+		t.Errorf("Expected --dry-run and --save to be set; got: %+v", a)
+	}
+}
+
+// Expect the config command to fail with its usage if no subcommand is given.
+func TestConfigCommandRequiresSubcommand(t *testing.T) {
+	var out bytes.Buffer
+	exited, code := false, 0
+	c := arg.Config{Program: "ddclient", Out: &out, Exit: func(c int) { exited, code = true, c }}
+
+	ParseArgsFrom(c, []string{"config", "--domain", "internet.com"})
+	if !exited || code == 0 {
+		t.Errorf("Got exited: %v, exit code: %v; want non-zero exit", exited, code)
+	}
+	if !strings.Contains(out.String(), "Usage: ddclient config") || !strings.Contains(out.String(), "a config command is required") {
+		t.Errorf("Expected config usage and error; got: %v", out.String())
+	}
+
+	out.Reset()
+	exited = false
+	if a := ParseArgsFrom(c, []string{"config", "validate"}); exited || a.Config.Validate == nil {
+		t.Errorf("Expected validate command to be parsed; got output: %v", out.String())
+	}
+}
+
+// Expect multi-word flags to be named in kebab case.
+func TestParsesKebabCaseFlags(t *testing.T) {
+	var a Args
+	p, err := arg.NewParser(arg.Config{}, &a)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = p.Parse([]string{"--multiple-records", "match", "--record-id", "42", "--run-timeout", "1m",
+		"--state-file", "state.json", "--verify-interval", "1h"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if a.MultipleRecords != MultipleRecordsMatch || a.RecordID != "42" || a.RunTimeout != Duration(time.Minute) ||
+		a.StateFile != "state.json" || a.VerifyInterval != Duration(time.Hour) {
+		t.Errorf("Got: %+v", a)
+	}
+}
+
 // ErrorContains checks if the error message in got contains the text in
 // want.
 //
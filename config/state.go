@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// DefaultVerifyInterval is how often records are checked with the provider while the IP address is
+// unchanged, if no interval is set.
+const DefaultVerifyInterval = Duration(24 * time.Hour)
+
+// State specifies options pertaining to remembering the IP address published to each record.
+type State struct {
+	StateFile      string   `arg:"--state-file" help:"file in which to remember the IP address published to each record, so the provider is only contacted when it changes"`
+	VerifyInterval Duration `arg:"--verify-interval" help:"how often to check records with the provider even if the IP address is unchanged (default: 24h)"`
+}
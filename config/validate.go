@@ -0,0 +1,311 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// SupportedTypes lists the types of record which can be kept up to date.
+var SupportedTypes = []string{"A", "AAAA"}
+
+// maxTTL is the largest TTL allowed by RFC 2181.
+const maxTTL = 1<<31 - 1
+
+// FieldError is a problem with a single setting.
+type FieldError struct {
+	// Field identifies the setting, e.g. "records[1].type".
+	Field string
+	// Message describes the problem, e.g. "not set".
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationError lists every problem found with a config. Use errors.As to inspect it, or to find
+// a particular *FieldError.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		s[i] = fe.Error()
+	}
+	return "Validation failed: " + strings.Join(s, ", ")
+}
+
+// Unwrap returns the problems found, so that errors.As can find a *FieldError.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// validator collects the problems found with a config.
+type validator struct {
+	errs []*FieldError
+}
+
+// add records a problem with field, described by the format and args.
+func (v *validator) add(field, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateConfig returns a *ValidationError describing every problem found with cfg, or nil if
+// there are none.
+func validateConfig(cfg *App) error {
+	v := &validator{}
+	if cfg.Record.Domain != "" || len(cfg.Records) == 0 {
+		v.validateRecord(cfg, cfg.Record, "")
+	}
+	for i, r := range cfg.Records {
+		v.validateRecord(cfg, r, fmt.Sprintf("records[%d].", i))
+	}
+	if cfg.Interval < 0 {
+		v.add("interval", "must be positive")
+	}
+	if cfg.RunTimeout < 0 {
+		v.add("run-timeout", "must be positive")
+	}
+	if cfg.VerifyInterval < 0 {
+		v.add("verify-interval", "must be positive")
+	}
+	// Only the sources of the address families used by the records need to reach the quorum.
+	types := map[string]bool{}
+	for _, r := range cfg.AllRecords() {
+		types[r.Type] = true
+	}
+	if q := cfg.Detection.Quorum; q < 1 {
+		v.add("ip-quorum", "must be positive")
+	} else if types["A"] && q > len(cfg.Detection.IPv4Sources) || types["AAAA"] && q > len(cfg.Detection.IPv6Sources) {
+		v.add("ip-quorum", "exceeds the number of IP address sources")
+	}
+	if cfg.HTTP.Timeout < 0 {
+		v.add("http-timeout", "must be positive")
+	}
+	if cfg.HTTP.MaxAttempts < 1 {
+		v.add("http-max-attempts", "must be positive")
+	}
+	if cfg.HTTP.Proxy != "" && !validURL(cfg.HTTP.Proxy) {
+		v.add("http-proxy", "must be a URL")
+	}
+	if ipv := cfg.HTTP.IPVersion; ipv != 0 && ipv != 4 && ipv != 6 {
+		v.add("http-ip-version", "must be 4 or 6")
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Logging.Level)); err != nil {
+		v.add("log-level", "%q not supported", cfg.Logging.Level)
+	}
+	switch cfg.Logging.Format {
+	case "text", "json":
+	default:
+		v.add("log-format", "%q not supported", cfg.Logging.Format)
+	}
+	if a := cfg.Metrics.Address; a != "" {
+		if _, _, err := net.SplitHostPort(a); err != nil {
+			v.add("metrics-address", "must be a host and port")
+		}
+	}
+	for i, n := range cfg.Notifications {
+		v.validateNotification(n, fmt.Sprintf("notifications[%d].", i))
+	}
+	if v.errs != nil {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+// validateRecord records each problem found with the given record. Each field is prefixed with
+// prefix so that the record can be identified.
+func (v *validator) validateRecord(cfg *App, r Record, prefix string) {
+	switch {
+	case r.Domain == "":
+		v.add(prefix+"domain", "not set")
+	case !validHostname(r.Domain, false) || !strings.Contains(r.Domain, "."):
+		v.add(prefix+"domain", "%q is not a valid domain name", r.Domain)
+	}
+	if r.Name != "" && !validHostname(r.Name, true) {
+		v.add(prefix+"name", "%q is not a valid record name", r.Name)
+	} else if len(r.FQDN()) > 253 {
+		v.add(prefix+"name", "makes the record name longer than 253 characters")
+	}
+	switch {
+	case r.Type == "":
+		v.add(prefix+"type", "not set")
+	case !contains(SupportedTypes, r.Type):
+		v.add(prefix+"type", "%q not supported; must be one of %s", r.Type, strings.Join(SupportedTypes, ", "))
+	}
+	if r.TTL < 0 {
+		v.add(prefix+"ttl", "must be positive")
+	} else if r.TTL > maxTTL {
+		v.add(prefix+"ttl", "must be at most %d", maxTTL)
+	}
+	switch r.MultipleRecords {
+	case "", MultipleRecordsError, MultipleRecordsUpdateAll, MultipleRecordsDedupe:
+	case MultipleRecordsMatch:
+		if r.RecordID == "" && r.Notes == "" {
+			v.add(prefix+"record-id", "or notes must be set to match records")
+		}
+	default:
+		v.add(prefix+"multiple-records", "policy %q not supported", r.MultipleRecords)
+	}
+	switch p := cfg.ProviderFor(r); p {
+	case "porkbun":
+		creds := cfg.PorkbunFor(r)
+		v.validateKey(prefix+"apikey", creds.APIKey, "pk1_", "sk1_")
+		v.validateKey(prefix+"secretkey", creds.SecretKey, "sk1_", "pk1_")
+		if r.TTL > 0 && r.TTL < 600 {
+			v.add(prefix+"ttl", "must be at least 600 for porkbun")
+		}
+	case "cloudflare":
+		token := cfg.CloudflareFor(r).APIToken
+		switch {
+		case token == "":
+			v.add(prefix+"apitoken", "not set")
+		case v.validateRef(prefix+"apitoken", token):
+		case strings.IndexFunc(token, func(c rune) bool { return !isTokenChar(c) }) >= 0:
+			v.add(prefix+"apitoken", "must only contain letters, digits, - and _")
+		}
+		if r.TTL > 1 && (r.TTL < 60 || r.TTL > 86400) {
+			v.add(prefix+"ttl", "must be 1 (automatic) or between 60 and 86400 for cloudflare")
+		}
+	case "rfc2136":
+		u := cfg.RFC2136For(r)
+		if u.Server == "" {
+			v.add(prefix+"rfc2136-server", "not set")
+		}
+		if u.TSIGKeyName == "" {
+			v.add(prefix+"tsig-key-name", "not set")
+		} else if !validHostname(strings.TrimSuffix(u.TSIGKeyName, "."), false) {
+			v.add(prefix+"tsig-key-name", "%q is not a valid key name", u.TSIGKeyName)
+		}
+		switch strings.TrimSuffix(strings.ToLower(u.TSIGAlgorithm), ".") {
+		case "", "hmac-sha1", "hmac-sha224", "hmac-sha256", "hmac-sha384", "hmac-sha512":
+		default:
+			v.add(prefix+"tsig-algorithm", "%q not supported", u.TSIGAlgorithm)
+		}
+		switch _, err := base64.StdEncoding.DecodeString(u.TSIGSecret); {
+		case u.TSIGSecret == "":
+			v.add(prefix+"tsig-secret", "not set")
+		case v.validateRef(prefix+"tsig-secret", u.TSIGSecret):
+		case err != nil:
+			v.add(prefix+"tsig-secret", "must be base64 encoded")
+		}
+	}
+}
+
+// validateKey records a problem with the Porkbun key in field if it is not set, contains
+// whitespace, or appears to be the other key as it starts with wrongPrefix rather than prefix.
+func (v *validator) validateKey(field, key, prefix, wrongPrefix string) {
+	switch {
+	case key == "":
+		v.add(field, "not set")
+	case v.validateRef(field, key):
+	case strings.IndexFunc(key, func(c rune) bool { return c <= ' ' || c == 0x7f }) >= 0:
+		v.add(field, "must not contain whitespace or control characters")
+	case strings.HasPrefix(key, wrongPrefix):
+		v.add(field, "starts with %s, but should start with %s; are the API and secret keys swapped?", wrongPrefix, prefix)
+	}
+}
+
+// validateRef reports whether the secret s is an unresolved reference, as when validating without
+// resolving secrets, in which case it records a problem if the reference is malformed. The secret
+// it refers to cannot be checked.
+func (v *validator) validateRef(field, s string) bool {
+	if !isSecretRef(s) {
+		return false
+	}
+	if err := checkSecretRef(s); err != nil {
+		v.add(field, "%v", err)
+	}
+	return true
+}
+
+// validateNotification records each problem found with the given notification. Each field is
+// prefixed with prefix so that the notification can be identified.
+func (v *validator) validateNotification(n Notification, prefix string) {
+	for _, ev := range n.Events {
+		switch ev {
+		case EventChanged, EventCreated, EventFailed:
+		default:
+			v.add(prefix+"event", "%q not supported", ev)
+		}
+	}
+	if n.FailAfter < 0 {
+		v.add(prefix+"failafter", "must be positive")
+	}
+	switch n.Type {
+	case NotifyWebhook, NotifyNtfy, NotifyGotify:
+		if !validURL(n.URL) {
+			v.add(prefix+"url", "must be a URL")
+		}
+		if n.Type == NotifyGotify && n.Token == "" {
+			v.add(prefix+"token", "not set")
+		}
+	case NotifySMTP:
+		if _, _, err := net.SplitHostPort(n.SMTPServer); err != nil {
+			v.add(prefix+"smtpserver", "must be a host and port")
+		}
+		if n.From == "" {
+			v.add(prefix+"from", "not set")
+		}
+		if len(n.To) == 0 {
+			v.add(prefix+"to", "not set")
+		}
+	case NotifyCommand:
+		if n.Command == "" {
+			v.add(prefix+"command", "not set")
+		}
+	default:
+		v.add(prefix+"type", "%q not supported", n.Type)
+	}
+}
+
+// validHostname reports whether s is a host name made up of labels of letters, digits and
+// hyphens, not starting or ending with a hyphen. If wildcard is set then the first label may be *.
+func validHostname(s string, wildcard bool) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for i, label := range strings.Split(s, ".") {
+		if wildcard && i == 0 && label == "*" {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func isTokenChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
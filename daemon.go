@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runDaemon checks the current IP address every interval and updates the DNS records whenever it
+// changes. It returns once ctx is cancelled, e.g. on SIGINT or SIGTERM, aborting any update in
+// progress.
+//
+// A failed update is not remembered, so it is retried on the next check even if the IP address
+// has not changed in the meantime. Unchanged records are also checked with the provider once the
+// updater's verify interval has passed.
+func runDaemon(ctx context.Context, u *updater, interval time.Duration) {
+	u.logger.Info("Running as daemon", "interval", interval)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if _, err := u.update(ctx); err != nil {
+			u.logger.Error(err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			u.logger.Info("Shutting down")
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/dns"
+	"github.com/bhorvath/ddclient/ipaddress"
+)
+
+// Expect the DNS record to be updated only when the IP address changes, and for the daemon to stop
+// once the context is cancelled.
+func TestDaemonUpdatesOnlyOnChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ih := &fakeIPAddressHandler{
+		ips:    []string{"10.0.0.1", "10.0.0.1", "10.0.0.2", "10.0.0.2", "10.0.0.1"},
+		onLast: cancel,
+	}
+	dh := &fakeDNSHandler{}
+	targets := []*target{{handler: dh}}
+
+	done := make(chan struct{})
+	go func() {
+		runDaemon(ctx, newTestUpdater(ih, targets...), time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Daemon did not stop after context was cancelled")
+	}
+
+	want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"}
+	if len(dh.updates) != len(want) {
+		t.Fatalf("Got updates: %v; want: %v", dh.updates, want)
+	}
+	for i := range want {
+		if dh.updates[i].String() != want[i] {
+			t.Errorf("Got updates: %v; want: %v", dh.updates, want)
+		}
+	}
+}
+
+// Expect a failed update to be retried on the next check even if the IP address has not changed.
+func TestDaemonRetriesFailedUpdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ih := &fakeIPAddressHandler{
+		ips:    []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"},
+		onLast: cancel,
+	}
+	dh := &fakeDNSHandler{failures: 1}
+
+	runDaemon(ctx, newTestUpdater(ih, &target{handler: dh}), time.Millisecond)
+
+	if len(dh.updates) != 2 {
+		t.Errorf("Got update calls: %v; want: 2", len(dh.updates))
+	}
+}
+
+// newTestUpdater returns an updater using ih as the only IP address handler, providing IPv4
+// addresses.
+func newTestUpdater(ih ipaddress.IPAddressHandler, targets ...*target) *updater {
+	return &updater{
+		ipHandlers:     map[ipaddress.Family]ipaddress.IPAddressHandler{ipaddress.IPv4: ih},
+		targets:        targets,
+		verifyInterval: time.Hour,
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+type fakeIPAddressHandler struct {
+	ips    []string
+	calls  int
+	onLast func()
+}
+
+func (h *fakeIPAddressHandler) GetCurrent(ctx context.Context) (netip.Addr, error) {
+	ip := h.ips[min(h.calls, len(h.ips)-1)]
+	h.calls++
+	if h.calls == len(h.ips) {
+		h.onLast()
+	}
+	return netip.ParseAddr(ip)
+}
+
+type fakeDNSHandler struct {
+	updates  []netip.Addr
+	failures int
+	// old is reported as the previous content of the record.
+	old string
+	// block makes updates wait until the context is done.
+	block bool
+}
+
+func (h *fakeDNSHandler) Update(ctx context.Context, ip netip.Addr) (dns.Result, error) {
+	h.updates = append(h.updates, ip)
+	if h.block {
+		<-ctx.Done()
+		return dns.Result{}, ctx.Err()
+	}
+	if h.failures > 0 {
+		h.failures--
+		return dns.Result{}, errFake
+	}
+	return dns.Result{Action: dns.Updated, Old: h.old, New: ip.String()}, nil
+}
+
+var errFake = errors.New("fake failure")
@@ -0,0 +1,318 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/retry"
+)
+
+// CloudflareBaseURL is the address of the Cloudflare API.
+const CloudflareBaseURL = "https://api.cloudflare.com/client/v4"
+
+const (
+	zonesEndpoint   = "/zones"
+	recordsEndpoint = "/dns_records"
+	// cloudflareAutoTTL is the TTL value which Cloudflare treats as automatic.
+	cloudflareAutoTTL = 1
+)
+
+type CloudflareDNSHandler struct {
+	baseURL string
+	record  config.Record
+	creds   config.Cloudflare
+	dryRun  bool
+	client  *http.Client
+	logger  *slog.Logger
+	zoneID  string
+}
+
+type cloudflareResponse struct {
+	Success bool              `json:"success"`
+	Errors  []cloudflareError `json:"errors"`
+	Result  json.RawMessage   `json:"result"`
+}
+
+type cloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type cloudflareZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func init() {
+	Register("cloudflare", func(o Options) (DNSHandler, error) {
+		return NewCloudflareDNSHandler(o.Client, o.Logger, CloudflareBaseURL, o.Record, o.Config.CloudflareFor(o.Record), o.DryRun)
+	})
+}
+
+// NewCloudflareDNSHandler allows a DNS record in Cloudflare to be read, updated or created using
+// client. If client is nil then retry.DefaultClient is used, and if logger is nil then
+// slog.Default() is. If dryRun is set then changes are reported but not made.
+func NewCloudflareDNSHandler(client *http.Client, logger *slog.Logger, baseURL string, record config.Record, creds config.Cloudflare, dryRun bool) (*CloudflareDNSHandler, error) {
+	if client == nil {
+		client = retry.DefaultClient
+	}
+	return &CloudflareDNSHandler{
+		baseURL: baseURL,
+		record:  record,
+		creds:   creds,
+		dryRun:  dryRun,
+		client:  client,
+		logger:  recordLogger(logger, "cloudflare", record),
+	}, nil
+}
+
+// Update either creates or updates a record based on the current IP address. If the current address
+// is the same as the record then no change is made, unless the record's TTL or comment differs from
+// that configured. The proxied flag, TTL and comment of an existing record are preserved unless a
+// TTL or notes have been configured, though the TTL of proxied records is always left automatic as
+// Cloudflare requires. If multiple records exist then the record's multiple records policy decides
+// which are updated or deleted. In dry run mode the records are retrieved but no change is made.
+func (h *CloudflareDNSHandler) Update(ctx context.Context, IP netip.Addr) (Result, error) {
+	if err := checkFamily(h.record.Type, IP); err != nil {
+		return Result{}, err
+	}
+
+	if h.zoneID == "" {
+		h.logger.Debug("looking up zone", "domain", h.record.Domain)
+		id, err := h.retrieveZoneID(ctx)
+		if err != nil {
+			return Result{}, err
+		}
+		h.zoneID = id
+	}
+
+	h.logger.Debug("retrieving records")
+	r, err := h.retrieveRecords(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	h.logger.Debug("found existing records", "count", len(r))
+	existing := make([]existingRecord, len(r))
+	for i, rec := range r {
+		existing[i] = existingRecord{ID: rec.ID, Content: rec.Content, Notes: rec.Comment}
+	}
+	keep, remove, err := selectRecords(h.record, existing, IP)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(keep) == 0 {
+		// Create new record
+		res := Result{Action: Created, New: h.describe(h.desiredRecord(cloudflareRecord{}, IP))}
+		if h.dryRun {
+			return res, nil
+		}
+		h.logger.Debug("creating record", "new", res.New)
+		err = h.createRecord(ctx, IP)
+		if err != nil {
+			return Result{}, err
+		}
+		return res, nil
+	}
+
+	var edits []cloudflareRecord
+	var olds, news []string
+	for _, i := range keep {
+		want := h.desiredRecord(r[i], IP)
+		olds = append(olds, h.describe(r[i]))
+		news = append(news, h.describe(want))
+		curIP, err := netip.ParseAddr(r[i].Content)
+		if err != nil {
+			return Result{}, err
+		}
+		if !compareIPs(curIP, IP) || h.settingsDrifted(r[i]) {
+			edits = append(edits, want)
+		}
+	}
+	res := Result{Old: strings.Join(olds, ", "), New: strings.Join(news, ", "), Deleted: len(remove)}
+	if len(edits) == 0 && len(remove) == 0 {
+		return res, nil
+	}
+
+	res.Action = Updated
+	if h.dryRun {
+		return res, nil
+	}
+	for _, e := range edits {
+		h.logger.Debug("editing record", "id", e.ID, "new", h.describe(e))
+		if err := h.editRecord(ctx, e); err != nil {
+			return Result{}, err
+		}
+	}
+	for _, i := range remove {
+		h.logger.Debug("deleting duplicate record", "id", r[i].ID, "old", r[i].Content)
+		if err := h.deleteRecord(ctx, r[i].ID); err != nil {
+			return Result{}, err
+		}
+	}
+	return res, nil
+}
+
+// settingsDrifted reports whether the TTL or comment of existing differ from those configured. The
+// TTL of proxied records is always automatic, so is not compared.
+func (h *CloudflareDNSHandler) settingsDrifted(existing cloudflareRecord) bool {
+	ttlDrifted := h.record.TTL != 0 && !existing.Proxied && existing.TTL != h.record.TTL
+	return ttlDrifted || h.record.Notes != "" && existing.Comment != h.record.Notes
+}
+
+// desiredRecord returns existing updated with the given IP address and the configured TTL and
+// notes. Settings which have not been configured are left as they are, as is the automatic TTL of
+// proxied records.
+func (h *CloudflareDNSHandler) desiredRecord(existing cloudflareRecord, ip netip.Addr) cloudflareRecord {
+	r := existing
+	r.Content = ip.String()
+	if h.record.TTL != 0 && !existing.Proxied {
+		r.TTL = h.record.TTL
+	}
+	if h.record.Notes != "" {
+		r.Comment = h.record.Notes
+	}
+	return r
+}
+
+// describe summarises r for reporting, including only the settings which have been configured.
+func (h *CloudflareDNSHandler) describe(r cloudflareRecord) string {
+	s := r.Content
+	if h.record.TTL != 0 {
+		s += fmt.Sprintf(" ttl %d", r.TTL)
+	}
+	if h.record.Notes != "" {
+		s += fmt.Sprintf(" comment %q", r.Comment)
+	}
+	return s
+}
+
+func (h *CloudflareDNSHandler) retrieveZoneID(ctx context.Context) (string, error) {
+	q := url.Values{"name": {h.record.Domain}}
+	var zones []cloudflareZone
+	err := h.do(ctx, http.MethodGet, zonesEndpoint+"?"+q.Encode(), nil, &zones)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve zone; %w", err)
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("no zone found for domain %s", h.record.Domain)
+	}
+	return zones[0].ID, nil
+}
+
+func (h *CloudflareDNSHandler) retrieveRecords(ctx context.Context) ([]cloudflareRecord, error) {
+	q := url.Values{"type": {h.record.Type}, "name": {h.record.FQDN()}}
+	var records []cloudflareRecord
+	err := h.do(ctx, http.MethodGet, h.recordsPath()+"?"+q.Encode(), nil, &records)
+	if err != nil {
+		return []cloudflareRecord{}, fmt.Errorf("failed to retrieve records; %w", err)
+	}
+	return records, nil
+}
+
+func (h *CloudflareDNSHandler) editRecord(ctx context.Context, r cloudflareRecord) error {
+	err := h.do(ctx, http.MethodPatch, h.recordsPath()+"/"+r.ID, r, nil)
+	if err != nil {
+		return fmt.Errorf("failed to edit record; %w", err)
+	}
+	return nil
+}
+
+func (h *CloudflareDNSHandler) createRecord(ctx context.Context, ip netip.Addr) error {
+	r := cloudflareRecord{
+		Type:    h.record.Type,
+		Name:    h.record.FQDN(),
+		Content: ip.String(),
+		TTL:     h.record.TTL,
+		Comment: h.record.Notes,
+	}
+	if r.TTL == 0 {
+		r.TTL = cloudflareAutoTTL
+	}
+	// Retrying a create whose response was lost would create a duplicate record.
+	err := h.do(retry.NonIdempotent(ctx), http.MethodPost, h.recordsPath(), r, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create record; %w", err)
+	}
+	return nil
+}
+
+func (h *CloudflareDNSHandler) deleteRecord(ctx context.Context, id string) error {
+	err := h.do(ctx, http.MethodDelete, h.recordsPath()+"/"+id, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete record; %w", err)
+	}
+	return nil
+}
+
+func (h *CloudflareDNSHandler) recordsPath() string {
+	return zonesEndpoint + "/" + h.zoneID + recordsEndpoint
+}
+
+// do sends an authenticated request to the Cloudflare API. If body is not nil it is sent as JSON,
+// and if result is not nil the result of a successful response is decoded into it.
+func (h *CloudflareDNSHandler) do(ctx context.Context, method string, path string, body any, result any) error {
+	var bodyReader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		bodyReader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL+path, bodyReader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.creds.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var cr cloudflareResponse
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	statusOK := res.StatusCode >= 200 && res.StatusCode < 300
+	if err := json.Unmarshal(resBody, &cr); err != nil || !statusOK || !cr.Success {
+		if len(cr.Errors) > 0 {
+			var msgs []string
+			for _, e := range cr.Errors {
+				msgs = append(msgs, fmt.Sprintf("%s (code %d)", e.Message, e.Code))
+			}
+			return errors.New(strings.Join(msgs, ", "))
+		}
+		return errors.New(string(resBody))
+	}
+
+	if result != nil {
+		return json.Unmarshal(cr.Result, result)
+	}
+	return nil
+}
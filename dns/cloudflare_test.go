@@ -0,0 +1,308 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bhorvath/ddclient/config"
+)
+
+var cfCreds = config.Cloudflare{APIToken: "token"}
+
+// Without a multiple records policy the handler refuses to update multiple records.
+func TestCloudflareUpdateFailOnMultipleRecords(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, rec, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+
+	if _, err := h.Update(context.Background(), ip); err == nil {
+		t.Error("Expected error; got nil")
+	}
+	if m.editCalls != 0 {
+		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
+	}
+	if m.createCalls != 0 {
+		t.Errorf("Got create calls: %v; want: 0", m.createCalls)
+	}
+}
+
+// With the dedupe policy the first record is updated and the others deleted.
+func TestCloudflareDedupeRecords(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.MultipleRecords = config.MultipleRecordsDedupe
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, r, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.editCalls != 1 || m.lastEditID != "test1" {
+		t.Errorf("Got edit calls: %v for %v; want: 1 for test1", m.editCalls, m.lastEditID)
+	}
+	if len(m.deletedIDs) != 1 || m.deletedIDs[0] != "test2" {
+		t.Errorf("Got deleted IDs: %v; want: [test2]", m.deletedIDs)
+	}
+}
+
+// If the current IP address is the same as the DNS record then don't edit or create anything.
+func TestCloudflareNoUpdateIfIPHasNotChanged(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, rec, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.records = []cloudflareRecord{{ID: "test2", Content: "10.0.0.1"}}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if m.editCalls != 0 {
+		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
+	}
+	if m.createCalls != 0 {
+		t.Errorf("Got create calls: %v; want: 0", m.createCalls)
+	}
+}
+
+// If the current IP address is different compared to the DNS record then update the record,
+// preserving its proxied flag and TTL.
+func TestCloudflareUpdateIfIPHasChanged(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, rec, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.records = []cloudflareRecord{{ID: "test2", Content: "10.0.0.4", TTL: 120, Proxied: true}}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if m.editCalls != 1 {
+		t.Fatalf("Got edit calls: %v; want: 1", m.editCalls)
+	}
+	if m.createCalls != 0 {
+		t.Errorf("Got create calls: %v; want: 0", m.createCalls)
+	}
+	want := cloudflareRecord{ID: "test2", Content: "10.0.0.1", TTL: 120, Proxied: true}
+	if m.lastEdit != want {
+		t.Errorf("Got edit: %+v; want: %+v", m.lastEdit, want)
+	}
+	if m.lastEditID != "test2" {
+		t.Errorf("Got edited record: %v; want: test2", m.lastEditID)
+	}
+}
+
+// If the TTL or notes configured differ from those of a record holding the current IP address then
+// correct them.
+func TestCloudflareUpdateIfSettingsHaveDrifted(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.TTL = 300
+	r.Notes = "ddclient"
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, r, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.records = []cloudflareRecord{{ID: "test2", Content: "10.0.0.1", TTL: 120, Comment: "ddclient"}}
+
+	res, err := h.Update(context.Background(), ip)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	wantRes := Result{Action: Updated, Old: `10.0.0.1 ttl 120 comment "ddclient"`, New: `10.0.0.1 ttl 300 comment "ddclient"`}
+	if res != wantRes {
+		t.Errorf("Got result: %+v; want: %+v", res, wantRes)
+	}
+	want := cloudflareRecord{ID: "test2", Content: "10.0.0.1", TTL: 300, Comment: "ddclient"}
+	if m.editCalls != 1 || m.lastEdit != want {
+		t.Errorf("Got edit calls: %v, edit: %+v; want: 1, %+v", m.editCalls, m.lastEdit, want)
+	}
+
+	// Expect no edit once the settings match.
+	m.records = []cloudflareRecord{want}
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if m.editCalls != 1 {
+		t.Errorf("Got edit calls: %v; want: 1", m.editCalls)
+	}
+
+	// Expect the automatic TTL of proxied records not to count as drift.
+	m.records = []cloudflareRecord{{ID: "test2", Content: "10.0.0.1", TTL: 1, Proxied: true, Comment: "ddclient"}}
+	res, err = h.Update(context.Background(), ip)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if res.Action != NoChange || m.editCalls != 1 {
+		t.Errorf("Got action: %v, edit calls: %v; want: %v, 1", res.Action, m.editCalls, NoChange)
+	}
+}
+
+// If the IP address of a proxied record changes then its automatic TTL is kept, even if a TTL has
+// been configured.
+func TestCloudflareUpdateKeepsProxiedTTL(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.TTL = 300
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, r, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.records = []cloudflareRecord{{ID: "test2", Content: "10.0.0.4", TTL: 1, Proxied: true}}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	want := cloudflareRecord{ID: "test2", Content: "10.0.0.1", TTL: 1, Proxied: true}
+	if m.lastEdit != want {
+		t.Errorf("Got edit: %+v; want: %+v", m.lastEdit, want)
+	}
+}
+
+// If there is no existing DNS record then create a new one.
+func TestCloudflareCreateIfNoRecord(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.TTL = 300
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, r, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.records = nil
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if m.editCalls != 0 {
+		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
+	}
+	if m.createCalls != 1 {
+		t.Fatalf("Got create calls: %v; want: 1", m.createCalls)
+	}
+	want := cloudflareRecord{Type: "A", Name: "subdomain.test.com", Content: "10.0.0.1", TTL: 300}
+	if m.lastCreate != want {
+		t.Errorf("Got create: %+v; want: %+v", m.lastCreate, want)
+	}
+}
+
+// Requests are authenticated with the API token and the zone is only looked up once.
+func TestCloudflareAuthenticatesAndCachesZone(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, rec, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.records = []cloudflareRecord{{ID: "test2", Content: "10.0.0.1"}}
+
+	h.Update(context.Background(), ip)
+	h.Update(context.Background(), ip)
+	if m.zoneCalls != 1 {
+		t.Errorf("Got zone calls: %v; want: 1", m.zoneCalls)
+	}
+	if m.lastAuth != "Bearer token" {
+		t.Errorf("Got authorization: %v; want: Bearer token", m.lastAuth)
+	}
+}
+
+// An error is returned if the domain's zone cannot be found.
+func TestCloudflareErrorIfNoZone(t *testing.T) {
+	m := NewMockCloudflareAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.Domain = "unknown.com"
+	h, err := NewCloudflareDNSHandler(nil, nil, m.svr.URL, r, cfCreds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+
+	if _, err := h.Update(context.Background(), ip); err == nil {
+		t.Error("Expected error; got nil")
+	}
+	if m.recordCalls != 0 {
+		t.Errorf("Got record calls: %v; want: 0", m.recordCalls)
+	}
+}
+
+type MockCloudflareAPI struct {
+	svr                                            *httptest.Server
+	records                                        []cloudflareRecord
+	zoneCalls, recordCalls, editCalls, createCalls int
+	lastEdit, lastCreate                           cloudflareRecord
+	lastEditID, lastAuth                           string
+	deletedIDs                                     []string
+}
+
+func NewMockCloudflareAPI() *MockCloudflareAPI {
+	return &MockCloudflareAPI{
+		records: []cloudflareRecord{
+			{ID: "test1", Content: "10.0.0.2"},
+			{ID: "test2", Content: "10.0.0.3"},
+		},
+	}
+}
+
+func (m *MockCloudflareAPI) setupRoutes() {
+	mux := http.NewServeMux()
+	svr := httptest.NewServer(mux)
+	mux.HandleFunc("GET "+zonesEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		m.zoneCalls++
+		m.lastAuth = r.Header.Get("Authorization")
+		var zones []cloudflareZone
+		if r.URL.Query().Get("name") == rec.Domain {
+			zones = append(zones, cloudflareZone{ID: "zone1", Name: rec.Domain})
+		}
+		writeCloudflareResult(w, zones)
+	})
+	mux.HandleFunc("GET "+zonesEndpoint+"/zone1"+recordsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		m.recordCalls++
+		writeCloudflareResult(w, m.records)
+	})
+	mux.HandleFunc("PATCH "+zonesEndpoint+"/zone1"+recordsEndpoint+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		m.editCalls++
+		m.lastEditID = r.PathValue("id")
+		json.NewDecoder(r.Body).Decode(&m.lastEdit)
+		writeCloudflareResult(w, m.lastEdit)
+	})
+	mux.HandleFunc("DELETE "+zonesEndpoint+"/zone1"+recordsEndpoint+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		m.deletedIDs = append(m.deletedIDs, r.PathValue("id"))
+		writeCloudflareResult(w, nil)
+	})
+	mux.HandleFunc("POST "+zonesEndpoint+"/zone1"+recordsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		m.createCalls++
+		json.NewDecoder(r.Body).Decode(&m.lastCreate)
+		writeCloudflareResult(w, m.lastCreate)
+	})
+	m.svr = svr
+}
+
+func writeCloudflareResult(w http.ResponseWriter, result any) {
+	r, _ := json.Marshal(result)
+	j, _ := json.Marshal(cloudflareResponse{Success: true, Result: r})
+	fmt.Fprint(w, string(j))
+}
@@ -1,7 +1,85 @@
 package dns
 
-import "net/netip"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
 
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/ipaddress"
+)
+
+// DNSHandler keeps a DNS record up to date with the current IP address. The context bounds every
+// request made to the provider.
 type DNSHandler interface {
-	Update(netip.Addr) error
+	Update(context.Context, netip.Addr) (Result, error)
+}
+
+// Action is a change made to a DNS record.
+type Action int
+
+const (
+	// NoChange means the record already held the current IP address.
+	NoChange Action = iota
+	// Created means a new record was created.
+	Created
+	// Updated means an existing record was edited.
+	Updated
+)
+
+func (a Action) String() string {
+	switch a {
+	case Created:
+		return "create"
+	case Updated:
+		return "update"
+	}
+	return "no change"
+}
+
+// Result describes the change made to a record by DNSHandler.Update. In dry run mode it describes
+// the change which would have been made.
+type Result struct {
+	Action Action
+	// Old is the content of the record before the change. It is empty for new records.
+	Old string
+	// New is the content of the record after the change.
+	New string
+	// Deleted is the number of duplicate records deleted.
+	Deleted int
+}
+
+// recordLogger returns logger, or slog.Default() if it is nil, annotated with the provider and
+// record being updated.
+func recordLogger(logger *slog.Logger, provider string, r config.Record) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("provider", provider, "record", r.FQDN(), "type", r.Type)
+}
+
+// RecordFamily returns the IP address family held by records of the given type. Only A and AAAA
+// records are supported.
+func RecordFamily(recordType string) (ipaddress.Family, error) {
+	switch recordType {
+	case "A":
+		return ipaddress.IPv4, nil
+	case "AAAA":
+		return ipaddress.IPv6, nil
+	}
+	return 0, fmt.Errorf("unsupported record type %q", recordType)
+}
+
+// checkFamily returns an error if ip cannot be stored in a record of the given type, e.g. an IPv6
+// address in an A record.
+func checkFamily(recordType string, ip netip.Addr) error {
+	f, err := RecordFamily(recordType)
+	if err != nil {
+		return err
+	}
+	if !f.Contains(ip) {
+		return fmt.Errorf("cannot store %v in %s record; expected an %v address", ip, recordType, f)
+	}
+	return nil
 }
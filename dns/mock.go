@@ -1,7 +1,8 @@
 package dns
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"net/netip"
 )
 
@@ -11,8 +12,8 @@ func NewMockDNSHandler() *MockDNSHandler {
 	return &MockDNSHandler{}
 }
 
-func (h *MockDNSHandler) Update(ip netip.Addr) error {
-	fmt.Println("Updated mock DNS")
+func (h *MockDNSHandler) Update(ctx context.Context, ip netip.Addr) (Result, error) {
+	slog.Debug("Updated mock DNS", "ip", ip)
 
-	return nil
+	return Result{Action: Updated, New: ip.String()}, nil
 }
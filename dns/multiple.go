@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/bhorvath/ddclient/config"
+)
+
+// existingRecord is the provider independent view of a retrieved record used to apply the multiple
+// records policy.
+type existingRecord struct {
+	ID      string
+	Content string
+	Notes   string
+}
+
+// selectRecords applies the multiple records policy of r to the existing records. It returns the
+// indices of the records which should be kept up to date with ip and of those which should be
+// deleted. If no records are to be kept up to date then a new record should be created.
+func selectRecords(r config.Record, existing []existingRecord, ip netip.Addr) (keep []int, remove []int, err error) {
+	if r.MultipleRecords == config.MultipleRecordsMatch {
+		for i, e := range existing {
+			if r.RecordID != "" && e.ID == r.RecordID || r.RecordID == "" && e.Notes == r.Notes {
+				keep = append(keep, i)
+			}
+		}
+		if r.RecordID != "" && len(keep) == 0 {
+			return nil, nil, fmt.Errorf("no record with ID %s found", r.RecordID)
+		}
+		if len(keep) > 1 {
+			return nil, nil, errors.New("more than one matching record found")
+		}
+		return keep, nil, nil
+	}
+
+	if len(existing) <= 1 {
+		for i := range existing {
+			keep = append(keep, i)
+		}
+		return keep, nil, nil
+	}
+
+	switch r.MultipleRecords {
+	case config.MultipleRecordsUpdateAll:
+		for i := range existing {
+			keep = append(keep, i)
+		}
+		return keep, nil, nil
+	case config.MultipleRecordsDedupe:
+		// Prefer keeping a record which already holds the current IP address so that it doesn't
+		// need to be edited.
+		k := 0
+		for i, e := range existing {
+			if cur, err := netip.ParseAddr(e.Content); err == nil && cur == ip {
+				k = i
+				break
+			}
+		}
+		for i := range existing {
+			if i != k {
+				remove = append(remove, i)
+			}
+		}
+		return []int{k}, remove, nil
+	}
+	return nil, nil, errors.New("more than one record to update found")
+}
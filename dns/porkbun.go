@@ -2,25 +2,38 @@ package dns
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/netip"
+	"strconv"
+	"strings"
 
 	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/retry"
 )
 
+// PorkbunBaseURL is the address of the Porkbun API.
+const PorkbunBaseURL = "https://api.porkbun.com"
+
 const (
 	retrieveEndpoint = "/api/json/v3/dns/retrieveByNameType"
-	editEndpoint     = "/api/json/v3/dns/editByNameType"
+	editEndpoint     = "/api/json/v3/dns/edit"
 	createEndpoint   = "/api/json/v3/dns/create"
+	deleteEndpoint   = "/api/json/v3/dns/delete"
 )
 
 type PorkbunDNSHandler struct {
 	baseURL string
-	config  *config.App
+	record  config.Record
+	creds   config.Porkbun
+	dryRun  bool
+	client  *http.Client
+	logger  *slog.Logger
 }
 
 type retrieveRequest struct {
@@ -46,7 +59,12 @@ type record struct {
 type editRequest struct {
 	APIKey       string `json:"apikey"`
 	SecretAPIKey string `json:"secretapikey"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
 	Content      string `json:"content"`
+	TTL          string `json:"ttl,omitempty"`
+	Prio         string `json:"prio,omitempty"`
+	Notes        string `json:"notes,omitempty"`
 }
 
 type createRequest struct {
@@ -55,77 +73,162 @@ type createRequest struct {
 	Name         string `json:"name"`
 	Type         string `json:"type"`
 	Content      string `json:"content"`
-	TTL          string `json:"ttl"`
+	TTL          string `json:"ttl,omitempty"`
+	Notes        string `json:"notes,omitempty"`
+}
+
+func init() {
+	Register("porkbun", func(o Options) (DNSHandler, error) {
+		return NewPorkbunDNSHandler(o.Client, o.Logger, PorkbunBaseURL, o.Record, o.Config.PorkbunFor(o.Record), o.DryRun)
+	})
 }
 
-// NewPorkbunDNSHandler allows a DNS record in Porkbun to be read, updated or created.
-func NewPorkbunDNSHandler(baseURL string, config *config.App) (*PorkbunDNSHandler, error) {
+// NewPorkbunDNSHandler allows a DNS record in Porkbun to be read, updated or created using client.
+// If client is nil then retry.DefaultClient is used, and if logger is nil then slog.Default() is. If
+// dryRun is set then changes are reported but not made.
+func NewPorkbunDNSHandler(client *http.Client, logger *slog.Logger, baseURL string, record config.Record, creds config.Porkbun, dryRun bool) (*PorkbunDNSHandler, error) {
+	if client == nil {
+		client = retry.DefaultClient
+	}
 	return &PorkbunDNSHandler{
 		baseURL: baseURL,
-		config:  config,
+		record:  record,
+		creds:   creds,
+		dryRun:  dryRun,
+		client:  client,
+		logger:  recordLogger(logger, "porkbun", record),
 	}, nil
 }
 
 // Update either creates or updates a record based on the current IP address. If the current address
-// is the same as the record then no change is made. Update does not currently support making changes
-// to multiple records, so an error is thrown if multiple records exist.
-func (h *PorkbunDNSHandler) Update(IP netip.Addr) error {
-	fmt.Print("Checking whether record exists... ")
-	r, err := h.retrieveRecords()
+// is the same as the record, and the record has the configured TTL and notes, then no
+// change is made. If multiple records exist then the record's multiple records policy decides which
+// are updated or deleted. An error is also returned if the address family does not match the
+// record type, e.g. an IPv6 address for an A record. In dry run mode the records are retrieved but
+// no change is made.
+func (h *PorkbunDNSHandler) Update(ctx context.Context, IP netip.Addr) (Result, error) {
+	if err := checkFamily(h.record.Type, IP); err != nil {
+		return Result{}, err
+	}
+
+	h.logger.Debug("retrieving records")
+	r, err := h.retrieveRecords(ctx)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
 
-	c := len(r)
-	fmt.Printf("Found %v existing record(s).\n", c)
-	if c > 1 {
-		return errors.New("more than one record to update found")
-	} else if c == 1 {
-		// Porkbun doesn't gracefully handle update requests if there is no change to the record and
-		// let's also avoid an unnecessary network request. Therefore only update if there is a genuine
-		// change in IP.
-		curIP, err := netip.ParseAddr(r[0].Content)
-		if err != nil {
-			return err
+	h.logger.Debug("found existing records", "count", len(r))
+	existing := make([]existingRecord, len(r))
+	for i, rec := range r {
+		existing[i] = existingRecord{ID: rec.Id, Content: rec.Content, Notes: rec.Notes}
+	}
+	keep, remove, err := selectRecords(h.record, existing, IP)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(keep) == 0 {
+		// Create new record
+		res := Result{Action: Created, New: h.describe(h.desiredRecord(record{}, IP))}
+		if h.dryRun {
+			return res, nil
 		}
-		if !compareIPs(curIP, IP) {
-			fmt.Print("IP has changed. Updating... ")
-			err = h.editRecord(IP)
-			if err != nil {
-				return err
-			}
-			fmt.Print("Done!\n")
-		} else {
-			fmt.Println("IP has not changed. Nothing to do.")
+		h.logger.Debug("creating record", "new", res.New)
+		err = h.createRecord(ctx, IP)
+		if err != nil {
+			return Result{}, err
 		}
-	} else {
-		// Create new record
-		fmt.Print("Creating new record... ")
-		err = h.createRecord(IP)
+		return res, nil
+	}
+
+	// Porkbun doesn't gracefully handle update requests if there is no change to the record and
+	// let's also avoid an unnecessary network request. Therefore only update if there is a genuine
+	// change in IP or a drift in the record's settings.
+	var edits []record
+	var olds, news []string
+	for _, i := range keep {
+		want := h.desiredRecord(r[i], IP)
+		olds = append(olds, h.describe(r[i]))
+		news = append(news, h.describe(want))
+		curIP, err := netip.ParseAddr(r[i].Content)
 		if err != nil {
-			return err
+			return Result{}, err
 		}
-		fmt.Print("Done!\n")
+		if !compareIPs(curIP, IP) || h.settingsDrifted(r[i]) {
+			edits = append(edits, want)
+		}
+	}
+	res := Result{Old: strings.Join(olds, ", "), New: strings.Join(news, ", "), Deleted: len(remove)}
+	if len(edits) == 0 && len(remove) == 0 {
+		return res, nil
 	}
 
-	return nil
+	res.Action = Updated
+	if h.dryRun {
+		return res, nil
+	}
+	for _, e := range edits {
+		h.logger.Debug("editing record", "id", e.Id, "new", h.describe(e))
+		if err := h.editRecord(ctx, e); err != nil {
+			return Result{}, err
+		}
+	}
+	for _, i := range remove {
+		h.logger.Debug("deleting duplicate record", "id", r[i].Id, "old", r[i].Content)
+		if err := h.deleteRecord(ctx, r[i].Id); err != nil {
+			return Result{}, err
+		}
+	}
+	return res, nil
+}
+
+// desiredRecord returns existing updated with the given IP address and the configured TTL and
+// notes. Settings which have not been configured are left as they are.
+func (h *PorkbunDNSHandler) desiredRecord(existing record, ip netip.Addr) record {
+	r := existing
+	r.Content = ip.String()
+	if h.record.TTL != 0 {
+		r.TTL = formatTTL(h.record.TTL)
+	}
+	if h.record.Notes != "" {
+		r.Notes = h.record.Notes
+	}
+	return r
 }
 
-func (h *PorkbunDNSHandler) retrieveRecords() ([]record, error) {
+// settingsDrifted reports whether the TTL or notes of existing differ from those configured.
+func (h *PorkbunDNSHandler) settingsDrifted(existing record) bool {
+	want := h.desiredRecord(existing, netip.Addr{})
+	return want.TTL != existing.TTL || want.Notes != existing.Notes
+}
+
+// describe summarises r for reporting, including only the settings which have been configured.
+func (h *PorkbunDNSHandler) describe(r record) string {
+	s := r.Content
+	if h.record.TTL != 0 {
+		s += " ttl " + r.TTL
+	}
+	if h.record.Notes != "" {
+		s += fmt.Sprintf(" notes %q", r.Notes)
+	}
+	return s
+}
+
+func (h *PorkbunDNSHandler) retrieveRecords(ctx context.Context) ([]record, error) {
 	body, err := json.Marshal(retrieveRequest{
-		APIKey:       h.config.APIKey,
-		SecretAPIKey: h.config.SecretKey,
+		APIKey:       h.creds.APIKey,
+		SecretAPIKey: h.creds.SecretKey,
 	})
 	if err != nil {
 		return []record{}, err
 	}
-	bodyReader := bytes.NewReader(body)
 
-	requestURL := h.baseURL + retrieveEndpoint + "/" + h.config.Domain + "/" + h.config.Type + "/" + h.config.Name
-	res, err := http.Post(requestURL, "application/json", bodyReader)
+	requestURL := h.baseURL + retrieveEndpoint + "/" + h.record.Domain + "/" + h.record.Type + "/" + h.record.Name
+	res, err := h.post(ctx, requestURL, body)
 	if err != nil {
 		return []record{}, err
 	}
+	defer res.Body.Close()
 
 	statusOK := res.StatusCode >= 200 && res.StatusCode < 300
 	if !statusOK {
@@ -142,22 +245,27 @@ func (h *PorkbunDNSHandler) retrieveRecords() ([]record, error) {
 	return rr.Records, nil
 }
 
-func (h *PorkbunDNSHandler) editRecord(ip netip.Addr) error {
+func (h *PorkbunDNSHandler) editRecord(ctx context.Context, r record) error {
 	body, err := json.Marshal(editRequest{
-		APIKey:       h.config.APIKey,
-		SecretAPIKey: h.config.SecretKey,
-		Content:      ip.String(),
+		APIKey:       h.creds.APIKey,
+		SecretAPIKey: h.creds.SecretKey,
+		Name:         h.record.Name,
+		Type:         h.record.Type,
+		Content:      r.Content,
+		TTL:          r.TTL,
+		Prio:         r.Prio,
+		Notes:        r.Notes,
 	})
 	if err != nil {
 		return err
 	}
-	bodyReader := bytes.NewReader(body)
 
-	requestURL := h.baseURL + editEndpoint + "/" + h.config.Domain + "/" + h.config.Type + "/" + h.config.Name
-	res, err := http.Post(requestURL, "application/json", bodyReader)
+	requestURL := h.baseURL + editEndpoint + "/" + h.record.Domain + "/" + r.Id
+	res, err := h.post(ctx, requestURL, body)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
 	statusOK := res.StatusCode >= 200 && res.StatusCode < 300
 	if !statusOK {
@@ -168,24 +276,27 @@ func (h *PorkbunDNSHandler) editRecord(ip netip.Addr) error {
 	return nil
 }
 
-func (h *PorkbunDNSHandler) createRecord(ip netip.Addr) error {
+func (h *PorkbunDNSHandler) createRecord(ctx context.Context, ip netip.Addr) error {
 	body, err := json.Marshal(createRequest{
-		APIKey:       h.config.APIKey,
-		SecretAPIKey: h.config.SecretKey,
-		Name:         h.config.Name,
-		Type:         h.config.Type,
+		APIKey:       h.creds.APIKey,
+		SecretAPIKey: h.creds.SecretKey,
+		Name:         h.record.Name,
+		Type:         h.record.Type,
 		Content:      ip.String(),
+		TTL:          formatTTL(h.record.TTL),
+		Notes:        h.record.Notes,
 	})
 	if err != nil {
 		return err
 	}
-	bodyReader := bytes.NewReader(body)
 
-	requestURL := h.baseURL + createEndpoint + "/" + h.config.Domain
-	res, err := http.Post(requestURL, "application/json", bodyReader)
+	// Retrying a create whose response was lost would create a duplicate record.
+	requestURL := h.baseURL + createEndpoint + "/" + h.record.Domain
+	res, err := h.post(retry.NonIdempotent(ctx), requestURL, body)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
 	statusOK := res.StatusCode >= 200 && res.StatusCode < 300
 	if !statusOK {
@@ -196,6 +307,50 @@ func (h *PorkbunDNSHandler) createRecord(ip netip.Addr) error {
 	return nil
 }
 
+func (h *PorkbunDNSHandler) deleteRecord(ctx context.Context, id string) error {
+	body, err := json.Marshal(retrieveRequest{
+		APIKey:       h.creds.APIKey,
+		SecretAPIKey: h.creds.SecretKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	requestURL := h.baseURL + deleteEndpoint + "/" + h.record.Domain + "/" + id
+	res, err := h.post(ctx, requestURL, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	statusOK := res.StatusCode >= 200 && res.StatusCode < 300
+	if !statusOK {
+		resBody, _ := io.ReadAll(res.Body)
+		return errors.New("failed to delete record; " + string(resBody))
+	}
+
+	return nil
+}
+
+// post sends body to the Porkbun API at requestURL.
+func (h *PorkbunDNSHandler) post(ctx context.Context, requestURL string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return h.client.Do(req)
+}
+
+// formatTTL returns the TTL as expected by the Porkbun API. A TTL of 0 is left empty so that the
+// Porkbun default is used.
+func formatTTL(ttl int) string {
+	if ttl == 0 {
+		return ""
+	}
+	return strconv.Itoa(ttl)
+}
+
 func compareIPs(curIP netip.Addr, newIP netip.Addr) bool {
 	return curIP == newIP
 }
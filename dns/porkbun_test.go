@@ -1,11 +1,15 @@
 package dns
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
+	"path"
+	"slices"
 	"testing"
 
 	"github.com/bhorvath/ddclient/config"
@@ -13,30 +17,28 @@ import (
 
 var (
 	ip, _ = netip.ParseAddr("10.0.0.1")
-	args  = &config.Args{
-		Record: config.Record{
-			Domain: "test.com",
-			Type:   "A",
-			Name:   "subdomain",
-		},
-		Porkbun: config.Porkbun{
-			APIKey:    "pk1_xxx",
-			SecretKey: "sk1_xxx",
-		},
+	rec   = config.Record{
+		Domain: "test.com",
+		Type:   "A",
+		Name:   "subdomain",
+	}
+	creds = config.Porkbun{
+		APIKey:    "pk1_xxx",
+		SecretKey: "sk1_xxx",
 	}
 )
 
-// The handler does not support updating multiple records.
+// Without a multiple records policy the handler refuses to update multiple records.
 func TestUpdateFailOnMultipleRecords(t *testing.T) {
 	m := NewMockPorkbunAPI()
 	m.setupRoutes()
 	defer m.svr.Close()
-	h, err := NewPorkbunDNSHandler(m.svr.URL, args)
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v ", err)
 	}
 
-	h.Update(ip)
+	h.Update(context.Background(), ip)
 	if m.editCalls != 0 {
 		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
 	}
@@ -51,7 +53,7 @@ func TestNoUpdateIfIPHasNotChanged(t *testing.T) {
 	m := NewMockPorkbunAPI()
 	m.setupRoutes()
 	defer m.svr.Close()
-	h, err := NewPorkbunDNSHandler(m.svr.URL, args)
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v ", err)
 	}
@@ -64,7 +66,7 @@ func TestNoUpdateIfIPHasNotChanged(t *testing.T) {
 		},
 	}
 
-	h.Update(ip)
+	h.Update(context.Background(), ip)
 	if m.editCalls != 0 {
 		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
 	}
@@ -78,7 +80,7 @@ func TestUpdateIfIPHasChanged(t *testing.T) {
 	m := NewMockPorkbunAPI()
 	m.setupRoutes()
 	defer m.svr.Close()
-	h, err := NewPorkbunDNSHandler(m.svr.URL, args)
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v ", err)
 	}
@@ -91,7 +93,7 @@ func TestUpdateIfIPHasChanged(t *testing.T) {
 		},
 	}
 
-	h.Update(ip)
+	h.Update(context.Background(), ip)
 	if m.editCalls != 1 {
 		t.Errorf("Got edit calls: %v; want: 1", m.editCalls)
 	}
@@ -105,13 +107,13 @@ func TestCreateIfNoRecord(t *testing.T) {
 	m := NewMockPorkbunAPI()
 	m.setupRoutes()
 	defer m.svr.Close()
-	h, err := NewPorkbunDNSHandler(m.svr.URL, args)
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v ", err)
 	}
 	m.retrieveResponse = retrieveResponse{}
 
-	h.Update(ip)
+	h.Update(context.Background(), ip)
 	if m.editCalls != 0 {
 		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
 	}
@@ -120,10 +122,372 @@ func TestCreateIfNoRecord(t *testing.T) {
 	}
 }
 
+// With the update-all policy every existing record is edited.
+func TestUpdateAllRecords(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.MultipleRecords = config.MultipleRecordsUpdateAll
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []string{"test1", "test2"}; !slices.Equal(m.editedIDs, want) {
+		t.Errorf("Got edited IDs: %v; want: %v", m.editedIDs, want)
+	}
+	if len(m.deletedIDs) != 0 {
+		t.Errorf("Got deleted IDs: %v; want: none", m.deletedIDs)
+	}
+}
+
+// With the dedupe policy the record already holding the current IP is kept and the others deleted.
+func TestDedupeRecords(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.MultipleRecords = config.MultipleRecordsDedupe
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{
+		"SUCCESS", []record{
+			{Id: "test1", Content: "10.0.0.2"},
+			{Id: "test2", Content: "10.0.0.1"},
+			{Id: "test3", Content: "10.0.0.3"},
+		},
+	}
+
+	res, err := h.Update(context.Background(), ip)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.editCalls != 0 {
+		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
+	}
+	if want := []string{"test1", "test3"}; !slices.Equal(m.deletedIDs, want) {
+		t.Errorf("Got deleted IDs: %v; want: %v", m.deletedIDs, want)
+	}
+	if res.Action != Updated || res.Deleted != 2 {
+		t.Errorf("Got: %v; want: update deleting 2 records", res)
+	}
+}
+
+// With the match policy only the record with the configured ID is edited.
+func TestUpdateMatchingRecordID(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.MultipleRecords = config.MultipleRecordsMatch
+	r.RecordID = "test2"
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []string{"test2"}; !slices.Equal(m.editedIDs, want) {
+		t.Errorf("Got edited IDs: %v; want: %v", m.editedIDs, want)
+	}
+}
+
+// With the match policy a record tagged with the configured notes is created if none exists, leaving
+// the other records alone.
+func TestCreateIfNoRecordMatchesNotes(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.MultipleRecords = config.MultipleRecordsMatch
+	r.Notes = "ddclient"
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.editCalls != 0 {
+		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
+	}
+	if m.createCalls != 1 || m.lastCreate.Notes != "ddclient" {
+		t.Errorf("Got create calls: %v with notes %q; want: 1 with notes \"ddclient\"", m.createCalls, m.lastCreate.Notes)
+	}
+}
+
+// Created records use the configured TTL.
+func TestCreateUsesRecordTTL(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.TTL = 900
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{}
+
+	h.Update(context.Background(), ip)
+	if m.createCalls != 1 {
+		t.Fatalf("Got create calls: %v; want: 1", m.createCalls)
+	}
+	if m.lastCreate.TTL != "900" {
+		t.Errorf("Got TTL: %v; want: 900", m.lastCreate.TTL)
+	}
+}
+
+// Created records use the configured notes.
+func TestCreateUsesRecordSettings(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.Notes = "managed by ddclient"
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{}
+
+	h.Update(context.Background(), ip)
+	if m.lastCreate.Notes != r.Notes {
+		t.Errorf("Got notes: %v; want: %v", m.lastCreate.Notes, r.Notes)
+	}
+}
+
+// Edits keep the existing TTL, priority and notes unless others have been configured.
+func TestEditPreservesRecordSettings(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.TTL = 900
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{
+		"SUCCESS", []record{
+			{
+				Id:      "test2",
+				Content: "10.0.0.4",
+				TTL:     "600",
+				Prio:    "5",
+				Notes:   "keep me",
+			},
+		},
+	}
+
+	h.Update(context.Background(), ip)
+	want := editRequest{
+		APIKey:       creds.APIKey,
+		SecretAPIKey: creds.SecretKey,
+		Name:         "subdomain",
+		Type:         "A",
+		Content:      "10.0.0.1",
+		TTL:          "900",
+		Prio:         "5",
+		Notes:        "keep me",
+	}
+	if m.lastEdit != want {
+		t.Errorf("Got: %+v; want: %+v", m.lastEdit, want)
+	}
+}
+
+// A record whose TTL has drifted from the configured TTL is edited even if the IP is unchanged.
+func TestUpdateCorrectsDriftedTTL(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	r := rec
+	r.TTL = 900
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, r, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{
+		"SUCCESS", []record{
+			{
+				Id:      "test2",
+				Content: "10.0.0.1",
+				TTL:     "600",
+			},
+		},
+	}
+
+	res, err := h.Update(context.Background(), ip)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Action != Updated {
+		t.Errorf("Got action: %v; want: %v", res.Action, Updated)
+	}
+	if m.editCalls != 1 {
+		t.Fatalf("Got edit calls: %v; want: 1", m.editCalls)
+	}
+	if m.lastEdit.TTL != "900" {
+		t.Errorf("Got TTL: %v; want: 900", m.lastEdit.TTL)
+	}
+}
+
+// In dry run mode a changed IP is reported as an update but the record is not edited.
+func TestDryRunReportsUpdate(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{
+		"SUCCESS", []record{
+			{
+				Id:      "test2",
+				Content: "10.0.0.4",
+			},
+		},
+	}
+
+	res, err := h.Update(context.Background(), ip)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := Result{Action: Updated, Old: "10.0.0.4", New: "10.0.0.1"}
+	if res != want {
+		t.Errorf("Got: %v; want: %v", res, want)
+	}
+	if m.editCalls != 0 {
+		t.Errorf("Got edit calls: %v; want: 0", m.editCalls)
+	}
+}
+
+// In dry run mode a missing record is reported as a create but not created.
+func TestDryRunReportsCreate(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{}
+
+	res, err := h.Update(context.Background(), ip)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Action != Created {
+		t.Errorf("Got action: %v; want: %v", res.Action, Created)
+	}
+	if m.createCalls != 0 {
+		t.Errorf("Got create calls: %v; want: 0", m.createCalls)
+	}
+}
+
+// Transient failures of the Porkbun API are retried.
+func TestRetriesTransientFailures(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.retrieveFailures = 1
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{}
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.retrieveCalls != 2 {
+		t.Errorf("Got retrieve calls: %v; want: 2", m.retrieveCalls)
+	}
+	if m.createCalls != 1 {
+		t.Errorf("Got create calls: %v; want: 1", m.createCalls)
+	}
+}
+
+// Creating a record is not retried after a server error, as the record may have been created.
+func TestDoesNotRetryCreate(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.createFailures = 1
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	m.retrieveResponse = retrieveResponse{}
+
+	if _, err := h.Update(context.Background(), ip); err == nil {
+		t.Error("Expected error; got nil")
+	}
+	if m.createCalls != 1 {
+		t.Errorf("Got create calls: %v; want: 1", m.createCalls)
+	}
+}
+
+// No requests are made once the context has been cancelled.
+func TestUpdateAbortsWhenCancelled(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := h.Update(ctx, ip); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled error; got: %v", err)
+	}
+	if m.retrieveCalls != 0 {
+		t.Errorf("Got retrieve calls: %v; want: 0", m.retrieveCalls)
+	}
+}
+
+// An address of the wrong family for the record type is refused without contacting Porkbun.
+func TestUpdateRefusesMismatchedFamily(t *testing.T) {
+	m := NewMockPorkbunAPI()
+	m.setupRoutes()
+	defer m.svr.Close()
+	h, err := NewPorkbunDNSHandler(nil, nil, m.svr.URL, rec, creds, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	ip6, _ := netip.ParseAddr("2001:db8::1")
+
+	if _, err := h.Update(context.Background(), ip6); err == nil {
+		t.Error("Expected error; got nil")
+	}
+	if m.retrieveCalls != 0 {
+		t.Errorf("Got retrieve calls: %v; want: 0", m.retrieveCalls)
+	}
+}
+
 type MockPorkbunAPI struct {
 	svr                                   *httptest.Server
 	retrieveResponse                      retrieveResponse
 	retrieveCalls, editCalls, createCalls int
+	lastCreate                            createRequest
+	lastEdit                              editRequest
+	editedIDs, deletedIDs                 []string
+	// retrieveFailures is the number of retrieve requests which fail before one succeeds.
+	retrieveFailures int
+	// createFailures is the number of create requests which fail before one succeeds.
+	createFailures int
 }
 
 func NewMockPorkbunAPI() *MockPorkbunAPI {
@@ -147,16 +511,30 @@ func NewMockPorkbunAPI() *MockPorkbunAPI {
 func (m *MockPorkbunAPI) setupRoutes() {
 	mux := http.NewServeMux()
 	svr := httptest.NewServer(mux)
-	mux.HandleFunc(retrieveEndpoint+"/*", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(retrieveEndpoint+"/", func(w http.ResponseWriter, r *http.Request) {
 		m.retrieveCalls++
+		if m.retrieveCalls <= m.retrieveFailures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		j, _ := json.Marshal(m.retrieveResponse)
 		fmt.Fprintf(w, string(j))
 	})
-	mux.HandleFunc(editEndpoint+"/*", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(editEndpoint+"/", func(w http.ResponseWriter, r *http.Request) {
 		m.editCalls++
+		m.editedIDs = append(m.editedIDs, path.Base(r.URL.Path))
+		json.NewDecoder(r.Body).Decode(&m.lastEdit)
+	})
+	mux.HandleFunc(deleteEndpoint+"/", func(w http.ResponseWriter, r *http.Request) {
+		m.deletedIDs = append(m.deletedIDs, path.Base(r.URL.Path))
 	})
-	mux.HandleFunc(createEndpoint+"/*", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(createEndpoint+"/", func(w http.ResponseWriter, r *http.Request) {
 		m.createCalls++
+		if m.createCalls <= m.createFailures {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&m.lastCreate)
 	})
 	m.svr = svr
 }
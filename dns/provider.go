@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/httpclient"
+)
+
+// Options are passed to a Factory when creating a DNSHandler for a record.
+type Options struct {
+	// Record is the record which the handler will update.
+	Record config.Record
+	// Config is the application configuration, from which provider credentials can be retrieved.
+	Config *config.App
+	// DryRun requests that changes are reported but not made.
+	DryRun bool
+	// Client is used by providers with an HTTP API. If nil, retry.DefaultClient is used.
+	Client *http.Client
+	// Logger receives the progress of updates. If nil, slog.Default() is used.
+	Logger *slog.Logger
+	// ObserveRequest, if set, is called with the time taken by each request made to the provider.
+	ObserveRequest func(time.Duration)
+}
+
+// Factory creates a DNSHandler for a single record hosted by a provider.
+type Factory func(o Options) (DNSHandler, error)
+
+var providers = make(map[string]Factory)
+
+// Register makes a DNS provider available under the given name, which is matched against the
+// provider configured for each record. It is intended to be called from an init function and
+// panics if the name is already registered.
+func Register(name string, f Factory) {
+	if _, ok := providers[name]; ok {
+		panic("dns: provider registered twice: " + name)
+	}
+	providers[name] = f
+}
+
+// Providers returns the names of all registered DNS providers in alphabetical order.
+func Providers() []string {
+	var names []string
+	for n := range providers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns a DNSHandler for o.Record using the provider configured for it.
+func New(o Options) (DNSHandler, error) {
+	name := o.Config.ProviderFor(o.Record)
+	f, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS provider %q; must be one of %s", name, strings.Join(Providers(), ", "))
+	}
+	if o.ObserveRequest != nil {
+		o.Client = httpclient.Timed(o.Client, o.ObserveRequest)
+	}
+	return f(o)
+}
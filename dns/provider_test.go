@@ -0,0 +1,101 @@
+package dns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+)
+
+// Records without a provider are handled by Porkbun.
+func TestNewDefaultsToPorkbun(t *testing.T) {
+	cfg := &config.App{Record: rec, Porkbun: creds}
+
+	h, err := New(Options{Record: rec, Config: cfg})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := h.(*PorkbunDNSHandler); !ok {
+		t.Errorf("Got handler: %T; want: *PorkbunDNSHandler", h)
+	}
+}
+
+// Records use the handler registered for their provider.
+func TestNewUsesRegisteredProvider(t *testing.T) {
+	Register("mock", func(o Options) (DNSHandler, error) {
+		return NewMockDNSHandler(), nil
+	})
+	defer delete(providers, "mock")
+	r := rec
+	r.Provider = "mock"
+
+	h, err := New(Options{Record: r, Config: &config.App{}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := h.(*MockDNSHandler); !ok {
+		t.Errorf("Got handler: %T; want: *MockDNSHandler", h)
+	}
+}
+
+// An error is returned for records using an unknown provider.
+func TestNewErrorsOnUnknownProvider(t *testing.T) {
+	r := rec
+	r.Provider = "unknown"
+
+	if _, err := New(Options{Record: r, Config: &config.App{}}); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Each request made by a provider with an HTTP API is observed.
+func TestNewTimesHTTPRequests(t *testing.T) {
+	var client *http.Client
+	Register("mock", func(o Options) (DNSHandler, error) {
+		client = o.Client
+		return NewMockDNSHandler(), nil
+	})
+	defer delete(providers, "mock")
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer svr.Close()
+	r := rec
+	r.Provider = "mock"
+	observed := 0
+
+	_, err := New(Options{Record: r, Config: &config.App{}, Client: svr.Client(), ObserveRequest: func(time.Duration) { observed++ }})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := client.Get(svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if observed != 1 {
+		t.Errorf("Got observed requests: %v; want: 1", observed)
+	}
+}
+
+// Each exchange with an RFC 2136 server is observed.
+func TestNewTimesRFC2136Exchanges(t *testing.T) {
+	m := NewMockDNSServer(t, "10.0.0.4")
+	r := rec
+	r.Provider = "rfc2136"
+	s := tsig
+	s.Server = m.addr
+	observed := 0
+
+	h, err := New(Options{Record: r, Config: &config.App{RFC2136: s}, ObserveRequest: func(time.Duration) { observed++ }})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if observed != 2 {
+		t.Errorf("Got observed requests: %v; want: 2", observed)
+	}
+}
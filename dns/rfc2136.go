@@ -0,0 +1,226 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+	mdns "github.com/miekg/dns"
+)
+
+const (
+	// defaultRFC2136TTL is the TTL given to records when none has been configured, as dynamic
+	// updates must always specify one.
+	defaultRFC2136TTL = 300
+	// tsigFudge is the number of seconds of clock skew permitted when the server verifies a signature.
+	tsigFudge = 300
+)
+
+type RFC2136DNSHandler struct {
+	server string
+	zone   string
+	fqdn   string
+	rrType uint16
+	ttl    uint32
+	// fixedTTL is set if a TTL has been configured, so that records with a different TTL are
+	// corrected.
+	fixedTTL  bool
+	keyName   string
+	algorithm string
+	dryRun    bool
+	client    *mdns.Client
+	logger    *slog.Logger
+	// observeRequest, if set, is called with the time taken by each exchange with the server.
+	observeRequest func(time.Duration)
+}
+
+func init() {
+	Register("rfc2136", func(o Options) (DNSHandler, error) {
+		h, err := NewRFC2136DNSHandler(o.Logger, o.Record, o.Config.RFC2136For(o.Record), o.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		h.observeRequest = o.ObserveRequest
+		return h, nil
+	})
+}
+
+// NewRFC2136DNSHandler allows a DNS record to be read and then updated or created by sending TSIG
+// signed RFC 2136 dynamic update messages directly to a DNS server. If logger is nil then
+// slog.Default() is used. If dryRun is set then changes are reported but not made.
+func NewRFC2136DNSHandler(logger *slog.Logger, record config.Record, settings config.RFC2136, dryRun bool) (*RFC2136DNSHandler, error) {
+	rrType, ok := mdns.StringToType[record.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %q", record.Type)
+	}
+
+	server := settings.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	zone := settings.Zone
+	if zone == "" {
+		zone = record.Domain
+	}
+	algorithm := settings.TSIGAlgorithm
+	if algorithm == "" {
+		algorithm = mdns.HmacSHA256
+	}
+	algorithm = mdns.Fqdn(strings.ToLower(algorithm))
+	switch algorithm {
+	case mdns.HmacSHA1, mdns.HmacSHA224, mdns.HmacSHA256, mdns.HmacSHA384, mdns.HmacSHA512:
+	default:
+		return nil, fmt.Errorf("unsupported TSIG algorithm %q", settings.TSIGAlgorithm)
+	}
+	ttl := record.TTL
+	if ttl == 0 {
+		ttl = defaultRFC2136TTL
+	}
+	keyName := mdns.Fqdn(strings.ToLower(settings.TSIGKeyName))
+
+	return &RFC2136DNSHandler{
+		server:    server,
+		zone:      mdns.Fqdn(zone),
+		fqdn:      mdns.Fqdn(record.FQDN()),
+		rrType:    rrType,
+		ttl:       uint32(ttl),
+		fixedTTL:  record.TTL != 0,
+		keyName:   keyName,
+		algorithm: algorithm,
+		dryRun:    dryRun,
+		client: &mdns.Client{
+			Net:        "udp",
+			TsigSecret: map[string]string{keyName: settings.TSIGSecret},
+		},
+		logger: recordLogger(logger, "rfc2136", record),
+	}, nil
+}
+
+// Update either creates or updates a record based on the current IP address. If the record already
+// holds only the current address, with the configured TTL if one has been set, then no change is
+// made. Otherwise every existing record of the configured name and type is replaced by a single
+// record holding the current address. In dry run mode the records are retrieved but no change is
+// made.
+func (h *RFC2136DNSHandler) Update(ctx context.Context, IP netip.Addr) (Result, error) {
+	if err := checkFamily(mdns.TypeToString[h.rrType], IP); err != nil {
+		return Result{}, err
+	}
+
+	h.logger.Debug("retrieving records")
+	r, ttl, err := h.retrieveRecords(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{New: h.describe(IP, h.ttl)}
+	var old []string
+	for _, ip := range r {
+		old = append(old, h.describe(ip, ttl))
+	}
+	res.Old = strings.Join(old, ", ")
+
+	c := len(r)
+	h.logger.Debug("found existing records", "count", c)
+	if c == 1 && compareIPs(r[0], IP) && (!h.fixedTTL || ttl == h.ttl) {
+		return res, nil
+	}
+
+	res.Action = Updated
+	if c == 0 {
+		res.Action = Created
+	}
+	if h.dryRun {
+		return res, nil
+	}
+
+	h.logger.Debug("replacing records", "old", res.Old, "new", res.New)
+	if err := h.replaceRecords(ctx, IP); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// describe summarises a record holding ip with the given TTL for reporting, including the TTL only if
+// one has been configured.
+func (h *RFC2136DNSHandler) describe(ip netip.Addr, ttl uint32) string {
+	if h.fixedTTL {
+		return fmt.Sprintf("%s ttl %d", ip, ttl)
+	}
+	return ip.String()
+}
+
+// retrieveRecords returns the addresses held by the record and their TTL.
+func (h *RFC2136DNSHandler) retrieveRecords(ctx context.Context) ([]netip.Addr, uint32, error) {
+	m := new(mdns.Msg)
+	m.SetQuestion(h.fqdn, h.rrType)
+	m.RecursionDesired = false
+	res, err := h.exchange(ctx, m)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve records; %w", err)
+	}
+	if res.Rcode != mdns.RcodeSuccess && res.Rcode != mdns.RcodeNameError {
+		return nil, 0, fmt.Errorf("failed to retrieve records; server responded %s", mdns.RcodeToString[res.Rcode])
+	}
+
+	var ips []netip.Addr
+	var ttl uint32
+	for _, rr := range res.Answer {
+		var ip net.IP
+		switch v := rr.(type) {
+		case *mdns.A:
+			ip = v.A
+		case *mdns.AAAA:
+			ip = v.AAAA
+		default:
+			continue
+		}
+		if a, ok := netip.AddrFromSlice(ip); ok {
+			ips = append(ips, a.Unmap())
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ips, ttl, nil
+}
+
+func (h *RFC2136DNSHandler) replaceRecords(ctx context.Context, ip netip.Addr) error {
+	rr, err := mdns.NewRR(fmt.Sprintf("%s %d IN %s %s", h.fqdn, h.ttl, mdns.TypeToString[h.rrType], ip))
+	if err != nil {
+		return err
+	}
+	m := new(mdns.Msg)
+	m.SetUpdate(h.zone)
+	m.RemoveRRset([]mdns.RR{rr})
+	m.Insert([]mdns.RR{rr})
+
+	res, err := h.exchange(ctx, m)
+	if err != nil {
+		return fmt.Errorf("failed to update record; %w", err)
+	}
+	if res.Rcode != mdns.RcodeSuccess {
+		return fmt.Errorf("failed to update record; server responded %s", mdns.RcodeToString[res.Rcode])
+	}
+	return nil
+}
+
+// exchange signs m with the TSIG key and sends it to the server.
+func (h *RFC2136DNSHandler) exchange(ctx context.Context, m *mdns.Msg) (*mdns.Msg, error) {
+	m.SetTsig(h.keyName, h.algorithm, tsigFudge, time.Now().Unix())
+	start := time.Now()
+	res, _, err := h.client.ExchangeContext(ctx, m, h.server)
+	if h.observeRequest != nil {
+		h.observeRequest(time.Since(start))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Truncated {
+		return nil, errors.New("response truncated")
+	}
+	return res, nil
+}
@@ -0,0 +1,235 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+	mdns "github.com/miekg/dns"
+)
+
+const tsigSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+
+var tsig = config.RFC2136{
+	TSIGKeyName: "ddclient",
+	TSIGSecret:  tsigSecret,
+}
+
+// If the current IP address is the same as the DNS record then don't send an update.
+func TestRFC2136NoUpdateIfIPHasNotChanged(t *testing.T) {
+	m := NewMockDNSServer(t, "10.0.0.1")
+	h := newTestRFC2136Handler(t, m, tsig)
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, calls := m.state(); calls != 0 {
+		t.Errorf("Got update calls: %v; want: 0", calls)
+	}
+}
+
+// If the current IP address is different compared to the DNS record then replace the record.
+func TestRFC2136UpdateIfIPHasChanged(t *testing.T) {
+	m := NewMockDNSServer(t, "10.0.0.4")
+	h := newTestRFC2136Handler(t, m, tsig)
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	records, calls := m.state()
+	if calls != 1 {
+		t.Errorf("Got update calls: %v; want: 1", calls)
+	}
+	if len(records) != 1 || records[0] != ip {
+		t.Errorf("Got records: %v; want: [%v]", records, ip)
+	}
+}
+
+// If a TTL has been configured then a record holding the current IP address with a different TTL is
+// corrected.
+func TestRFC2136UpdateIfTTLHasDrifted(t *testing.T) {
+	m := NewMockDNSServer(t, "10.0.0.1")
+	s := tsig
+	s.Server = m.addr
+	r := rec
+	r.TTL = 600
+	h, err := NewRFC2136DNSHandler(nil, r, s, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+
+	res, err := h.Update(context.Background(), ip)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	want := Result{Action: Updated, Old: "10.0.0.1 ttl 300", New: "10.0.0.1 ttl 600"}
+	if res != want {
+		t.Errorf("Got result: %+v; want: %+v", res, want)
+	}
+	_, calls := m.state()
+	m.mu.Lock()
+	ttl := m.ttl
+	m.mu.Unlock()
+	if calls != 1 || ttl != 600 {
+		t.Errorf("Got update calls: %v, TTL: %v; want: 1, 600", calls, ttl)
+	}
+
+	// Expect no further update once the TTL has been corrected.
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, calls := m.state(); calls != 1 {
+		t.Errorf("Got update calls: %v; want: 1", calls)
+	}
+}
+
+// Multiple existing records are replaced by a single record holding the current IP address.
+func TestRFC2136ReplacesMultipleRecords(t *testing.T) {
+	m := NewMockDNSServer(t, "10.0.0.2", "10.0.0.3")
+	h := newTestRFC2136Handler(t, m, tsig)
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if records, _ := m.state(); len(records) != 1 || records[0] != ip {
+		t.Errorf("Got records: %v; want: [%v]", records, ip)
+	}
+}
+
+// If there is no existing DNS record then create a new one.
+func TestRFC2136CreateIfNoRecord(t *testing.T) {
+	m := NewMockDNSServer(t)
+	h := newTestRFC2136Handler(t, m, tsig)
+
+	if _, err := h.Update(context.Background(), ip); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	records, calls := m.state()
+	if calls != 1 {
+		t.Errorf("Got update calls: %v; want: 1", calls)
+	}
+	if len(records) != 1 || records[0] != ip {
+		t.Errorf("Got records: %v; want: [%v]", records, ip)
+	}
+}
+
+// Updates signed with the wrong TSIG key are rejected.
+func TestRFC2136ErrorOnBadKey(t *testing.T) {
+	m := NewMockDNSServer(t)
+	bad := tsig
+	bad.TSIGSecret = "d3Jvbmctd3Jvbmctd3Jvbmc="
+	h := newTestRFC2136Handler(t, m, bad)
+
+	if _, err := h.Update(context.Background(), ip); err == nil {
+		t.Error("Expected error; got nil")
+	}
+	if records, _ := m.state(); len(records) != 0 {
+		t.Errorf("Got records: %v; want: none", records)
+	}
+}
+
+// Unsupported TSIG algorithms are refused when creating the handler.
+func TestRFC2136ErrorOnUnsupportedAlgorithm(t *testing.T) {
+	s := tsig
+	s.TSIGAlgorithm = "hmac-md4"
+
+	if _, err := NewRFC2136DNSHandler(nil, rec, s, false); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+func newTestRFC2136Handler(t *testing.T, m *MockDNSServer, s config.RFC2136) *RFC2136DNSHandler {
+	s.Server = m.addr
+	h, err := NewRFC2136DNSHandler(nil, rec, s, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v ", err)
+	}
+	return h
+}
+
+// MockDNSServer is an in-process authoritative server for the zone of rec which accepts dynamic
+// updates for rec signed with the test TSIG key.
+type MockDNSServer struct {
+	addr        string
+	mu          sync.Mutex
+	records     []netip.Addr
+	ttl         uint32
+	updateCalls int
+}
+
+func NewMockDNSServer(t *testing.T, records ...string) *MockDNSServer {
+	m := &MockDNSServer{ttl: 300}
+	for _, r := range records {
+		m.records = append(m.records, netip.MustParseAddr(r))
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	started := make(chan struct{})
+	svr := &mdns.Server{
+		PacketConn:        pc,
+		Handler:           mdns.HandlerFunc(m.serveDNS),
+		TsigSecret:        map[string]string{mdns.Fqdn(tsig.TSIGKeyName): tsigSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// The default accept function refuses dynamic updates.
+		MsgAcceptFunc: func(mdns.Header) mdns.MsgAcceptAction { return mdns.MsgAccept },
+	}
+	go svr.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { svr.Shutdown() })
+	m.addr = pc.LocalAddr().String()
+	return m
+}
+
+// state returns the records held by the server and the number of updates received.
+func (m *MockDNSServer) state() ([]netip.Addr, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.records, m.updateCalls
+}
+
+func (m *MockDNSServer) serveDNS(w mdns.ResponseWriter, r *mdns.Msg) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := new(mdns.Msg)
+	res.SetReply(r)
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		res.Rcode = mdns.RcodeNotAuth
+		w.WriteMsg(res)
+		return
+	}
+	res.SetTsig(r.IsTsig().Hdr.Name, r.IsTsig().Algorithm, tsigFudge, time.Now().Unix())
+
+	fqdn := mdns.Fqdn(rec.FQDN())
+	switch r.Opcode {
+	case mdns.OpcodeQuery:
+		for _, ip := range m.records {
+			rr, _ := mdns.NewRR(fmt.Sprintf("%s %d IN A %s", fqdn, m.ttl, ip))
+			res.Answer = append(res.Answer, rr)
+		}
+	case mdns.OpcodeUpdate:
+		m.updateCalls++
+		if r.Question[0].Name != mdns.Fqdn(rec.Domain) {
+			res.Rcode = mdns.RcodeNotZone
+			break
+		}
+		for _, rr := range r.Ns {
+			switch {
+			case rr.Header().Class == mdns.ClassANY:
+				m.records = nil
+			case rr.Header().Class == mdns.ClassINET:
+				a := rr.(*mdns.A)
+				m.records = append(m.records, netip.MustParseAddr(a.A.String()))
+				m.ttl = a.Hdr.Ttl
+			}
+		}
+	}
+	w.WriteMsg(res)
+}
@@ -3,6 +3,17 @@ module github.com/bhorvath/ddclient
 go 1.22.5
 
 require (
-	github.com/alexflint/go-arg v1.5.1 // indirect
-	github.com/alexflint/go-scalar v1.2.0 // indirect
+	github.com/BurntSushi/toml v1.4.0
+	github.com/alexflint/go-arg v1.5.1
+	github.com/alexflint/go-scalar v1.2.0
+	github.com/miekg/dns v1.1.62
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/mod v0.18.0 // indirect
+	golang.org/x/net v0.27.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/tools v0.22.0 // indirect
 )
@@ -0,0 +1,113 @@
+// Package httpclient builds the HTTP client used to contact DNS providers and IP address services.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/bhorvath/ddclient/retry"
+)
+
+// Options specify how the client makes requests.
+type Options struct {
+	// Timeout bounds each request, including any retries. Zero means no timeout.
+	Timeout time.Duration
+	// Proxy is the URL of the proxy to send requests through. If empty, the proxy is taken from the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string
+	// CABundle is the path of a PEM file of CA certificates to trust in addition to the system
+	// certificates.
+	CABundle string
+	// IPVersion forces connections over IPv4 (4) or IPv6 (6). Zero allows either.
+	IPVersion int
+	// Retry specifies how requests failing with transient errors are retried.
+	Retry retry.Policy
+}
+
+// New returns an HTTP client configured according to o.
+func New(o Options) (*http.Client, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if o.CABundle != "" {
+		pem, err := os.ReadFile(o.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA bundle " + o.CABundle)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	switch o.IPVersion {
+	case 0:
+	case 4, 6:
+		network := fmt.Sprintf("tcp%d", o.IPVersion)
+		d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		t.DialContext = func(ctx context.Context, _ string, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, network, addr)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported IP version %d", o.IPVersion)
+	}
+
+	return &http.Client{
+		Transport: retry.NewTransport(t, o.Retry),
+		Timeout:   o.Timeout,
+	}, nil
+}
+
+// Timed returns a copy of c which calls observe with the time taken by each request it sends, until
+// the response headers are received. Each attempt at a request retried by c is timed separately,
+// so that the delay before a retry is not counted. If c is nil then retry.DefaultClient is copied.
+func Timed(c *http.Client, observe func(time.Duration)) *http.Client {
+	if c == nil {
+		c = retry.DefaultClient
+	}
+	timed := *c
+	if rt, ok := c.Transport.(*retry.Transport); ok {
+		r := *rt
+		r.Base = &timingTransport{base: rt.Base, observe: observe}
+		timed.Transport = &r
+	} else {
+		timed.Transport = &timingTransport{base: c.Transport, observe: observe}
+	}
+	return &timed
+}
+
+// timingTransport is an http.RoundTripper reporting the time taken by each request.
+type timingTransport struct {
+	base    http.RoundTripper
+	observe func(time.Duration)
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	res, err := base.RoundTrip(req)
+	t.observe(time.Since(start))
+	return res, err
+}
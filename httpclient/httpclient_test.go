@@ -0,0 +1,154 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/retry"
+)
+
+var testRetry = retry.Policy{MaxAttempts: 1}
+
+// Expect requests to be sent through the configured proxy.
+func TestUsesProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, "ok")
+	}))
+	defer proxy.Close()
+
+	c, err := New(Options{Proxy: proxy.URL, Retry: testRetry})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := c.Get("http://ddclient.invalid/ip")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if proxied != "http://ddclient.invalid/ip" {
+		t.Errorf("Got proxied request: %v; want: http://ddclient.invalid/ip", proxied)
+	}
+}
+
+// Expect servers with certificates signed by a CA in the bundle to be trusted.
+func TestTrustsCABundle(t *testing.T) {
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer svr.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw})
+	os.WriteFile(bundle, cert, 0600)
+
+	c, err := New(Options{Retry: testRetry})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.Get(svr.URL); err == nil {
+		t.Error("Expected certificate error without CA bundle; got nil")
+	}
+
+	c, err = New(Options{CABundle: bundle, Retry: testRetry})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := c.Get(svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+}
+
+// Expect an error if the CA bundle contains no certificates.
+func TestErrorIfCABundleInvalid(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(bundle, []byte("not a certificate"), 0600)
+
+	if _, err := New(Options{CABundle: bundle}); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Expect requests to a hung server to time out.
+func TestTimesOut(t *testing.T) {
+	done := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer svr.Close()
+	defer close(done)
+
+	c, err := New(Options{Timeout: 50 * time.Millisecond, Retry: testRetry})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.Get(svr.URL); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Expect connections forced over IPv6 to fail for servers only listening on IPv4.
+func TestForcesIPVersion(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer svr.Close()
+
+	c, err := New(Options{IPVersion: 4, Retry: testRetry})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := c.Get(svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	c, _ = New(Options{IPVersion: 6, Retry: testRetry})
+	if _, err := c.Get(svr.URL); err == nil {
+		t.Error("Expected error connecting to IPv4 server over IPv6; got nil")
+	}
+}
+
+// Expect each attempt at a retried request to be timed, without affecting the original client.
+func TestTimesEachAttempt(t *testing.T) {
+	attempts := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer svr.Close()
+
+	c, err := New(Options{Retry: retry.Policy{MaxAttempts: 2}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var observed []time.Duration
+	res, err := Timed(c, func(d time.Duration) { observed = append(observed, d) }).Get(svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if len(observed) != 2 {
+		t.Errorf("Got %d observations; want: 2", len(observed))
+	}
+
+	res, err = c.Get(svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if len(observed) != 2 {
+		t.Errorf("Expected original client not to be timed; got %d observations", len(observed))
+	}
+}
@@ -0,0 +1,63 @@
+package ipaddress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// CompositeIPAddressHandler detects the current IP address using several sources, falling back to
+// the next source whenever one fails and optionally requiring multiple sources to agree.
+type CompositeIPAddressHandler struct {
+	family   Family
+	handlers []IPAddressHandler
+	quorum   int
+}
+
+// NewCompositeIPAddressHandler returns a handler which queries handlers in order until quorum of
+// them have returned the same address of the given family. Sources which fail or return an address
+// of the wrong family are skipped. A quorum of 1 simply returns the first address found.
+func NewCompositeIPAddressHandler(f Family, handlers []IPAddressHandler, quorum int) *CompositeIPAddressHandler {
+	return &CompositeIPAddressHandler{
+		family:   f,
+		handlers: handlers,
+		quorum:   max(quorum, 1),
+	}
+}
+
+// GetCurrent returns the current public IP address of the client once enough sources agree on it.
+// An error is returned if the sources are exhausted before the quorum is reached, or if ctx is done.
+func (h *CompositeIPAddressHandler) GetCurrent(ctx context.Context) (netip.Addr, error) {
+	votes := make(map[netip.Addr]int)
+	var errs []error
+	for i, s := range h.handlers {
+		if err := ctx.Err(); err != nil {
+			return netip.Addr{}, err
+		}
+		ip, err := s.GetCurrent(ctx)
+		if err == nil && !h.family.Contains(ip) {
+			err = fmt.Errorf("expected an %v address; got: %v", h.family, ip)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source %d: %w", i+1, err))
+			continue
+		}
+
+		votes[ip]++
+		if votes[ip] >= h.quorum {
+			return ip, nil
+		}
+	}
+
+	switch {
+	case len(votes) > 1:
+		errs = append(errs, fmt.Errorf("sources disagree: %v", votes))
+	case len(votes) == 1:
+		errs = append(errs, errors.New("too few sources returned an address"))
+	case len(errs) == 0:
+		errs = append(errs, errors.New("no sources configured"))
+	}
+	return netip.Addr{}, fmt.Errorf("%v of %v source(s) required to agree on the current address: %w",
+		h.quorum, len(h.handlers), errors.Join(errs...))
+}
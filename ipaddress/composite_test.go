@@ -0,0 +1,116 @@
+package ipaddress
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+// Fall back to the next source if one fails.
+func TestCompositeFallsBackOnFailure(t *testing.T) {
+	failing := &fakeSource{err: errors.New("unavailable")}
+	working := &fakeSource{ip: "10.0.0.1"}
+	h := NewCompositeIPAddressHandler(IPv4, []IPAddressHandler{failing, working}, 1)
+
+	got, err := h.GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "10.0.0.1" {
+		t.Errorf("Got: %v; want: 10.0.0.1", got)
+	}
+}
+
+// Stop querying sources once the quorum has been reached.
+func TestCompositeStopsOnceQuorumReached(t *testing.T) {
+	first := &fakeSource{ip: "10.0.0.1"}
+	second := &fakeSource{ip: "10.0.0.1"}
+	unused := &fakeSource{ip: "10.0.0.1"}
+	h := NewCompositeIPAddressHandler(IPv4, []IPAddressHandler{first, second, unused}, 2)
+
+	if _, err := h.GetCurrent(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if unused.calls != 0 {
+		t.Errorf("Got calls: %v; want: 0", unused.calls)
+	}
+}
+
+// A single misbehaving source cannot provide the address when a quorum is required.
+func TestCompositeRequiresQuorum(t *testing.T) {
+	h := NewCompositeIPAddressHandler(IPv4, []IPAddressHandler{
+		&fakeSource{ip: "10.0.0.1"},
+		&fakeSource{ip: "10.0.0.66"},
+		&fakeSource{ip: "10.0.0.1"},
+	}, 2)
+
+	got, err := h.GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "10.0.0.1" {
+		t.Errorf("Got: %v; want: 10.0.0.1", got)
+	}
+}
+
+// Return an error if the sources are exhausted without reaching the quorum.
+func TestCompositeErrorIfNoQuorum(t *testing.T) {
+	h := NewCompositeIPAddressHandler(IPv4, []IPAddressHandler{
+		&fakeSource{ip: "10.0.0.1"},
+		&fakeSource{ip: "10.0.0.66"},
+		&fakeSource{err: errors.New("unavailable")},
+	}, 2)
+
+	if _, err := h.GetCurrent(context.Background()); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Addresses of the wrong family are treated as a failure of the source.
+func TestCompositeSkipsWrongFamily(t *testing.T) {
+	h := NewCompositeIPAddressHandler(IPv6, []IPAddressHandler{
+		&fakeSource{ip: "10.0.0.1"},
+		&fakeSource{ip: "2001:db8::1"},
+	}, 1)
+
+	got, err := h.GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "2001:db8::1" {
+		t.Errorf("Got: %v; want: 2001:db8::1", got)
+	}
+}
+
+// Well known sources and URLs are accepted, but anything else is refused.
+func TestNewSource(t *testing.T) {
+	for _, s := range []string{"ipify", "icanhazip", "ifconfig.me", "https://ip.example.com/", "interface:eth0", "upnp", "upnp:192.168.1.1"} {
+		if _, err := NewSource(s, IPv4, SourceOptions{}); err != nil {
+			t.Errorf("Unexpected error for %q: %v", s, err)
+		}
+	}
+	if _, err := NewSource("unknown", IPv4, SourceOptions{}); err == nil {
+		t.Error("Expected error; got nil")
+	}
+	// Expect an error for sources which cannot provide IPv6 addresses.
+	for _, s := range []string{"ifconfig.me", "upnp"} {
+		if _, err := NewSource(s, IPv6, SourceOptions{}); err == nil {
+			t.Errorf("Expected error for %q; got nil", s)
+		}
+	}
+}
+
+type fakeSource struct {
+	ip    string
+	err   error
+	calls int
+}
+
+func (s *fakeSource) GetCurrent(ctx context.Context) (netip.Addr, error) {
+	s.calls++
+	if s.err != nil {
+		return netip.Addr{}, s.err
+	}
+	return netip.ParseAddr(s.ip)
+}
@@ -0,0 +1,143 @@
+package ipaddress
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Flags of IPv6 addresses as reported by Linux in /proc/net/if_inet6.
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+)
+
+// InterfaceIPAddressHandler retrieves the current IP address from one of the addresses assigned to
+// a local network interface.
+type InterfaceIPAddressHandler struct {
+	name         string
+	family       Family
+	allowPrivate bool
+	// addrs lists the addresses assigned to the named interface.
+	addrs func(name string) ([]interfaceAddr, error)
+}
+
+// interfaceAddr is an address assigned to a network interface.
+type interfaceAddr struct {
+	ip netip.Addr
+	// temporary is set for IPv6 privacy extension addresses, which change regularly.
+	temporary bool
+	// unusable is set for addresses which are deprecated or still undergoing duplicate address
+	// detection.
+	unusable bool
+}
+
+// NewInterfaceIPAddressHandler returns a handler which reads the address of the given family from
+// the named interface. Unless allowPrivate is set, only public addresses are used.
+func NewInterfaceIPAddressHandler(name string, f Family, allowPrivate bool) *InterfaceIPAddressHandler {
+	return &InterfaceIPAddressHandler{name: name, family: f, allowPrivate: allowPrivate, addrs: systemInterfaceAddrs}
+}
+
+// GetCurrent returns a public IP address of the configured family assigned to the interface.
+// Loopback and link-local addresses are skipped, as are private (including IPv6 ULA), CGNAT and
+// documentation addresses unless private addresses are allowed, and temporary IPv6 privacy
+// addresses. If several addresses remain the lowest is returned, so that the same
+// address is chosen each time. As the addresses are read locally, ctx is not used.
+func (h *InterfaceIPAddressHandler) GetCurrent(ctx context.Context) (netip.Addr, error) {
+	addrs, err := h.addrs(h.name)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	var best netip.Addr
+	for _, a := range addrs {
+		ip := a.ip.Unmap()
+		if !h.family.Contains(ip) || a.temporary || a.unusable || !ip.IsGlobalUnicast() {
+			continue
+		}
+		if !h.allowPrivate && checkPublic(ip) != nil {
+			continue
+		}
+		if !best.IsValid() || ip.Less(best) {
+			best = ip
+		}
+	}
+	if !best.IsValid() {
+		return netip.Addr{}, fmt.Errorf("no public %v address found on interface %s", h.family, h.name)
+	}
+	return best, nil
+}
+
+// systemInterfaceAddrs returns the addresses assigned to the named interface. On Linux the IPv6
+// address flags are read from /proc/net/if_inet6 so that temporary addresses can be identified.
+func systemInterfaceAddrs(name string) ([]interfaceAddr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	netAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	flags := inet6Flags(name)
+
+	var addrs []interfaceAddr
+	for _, na := range netAddrs {
+		ipNet, ok := na.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		f := flags[ip]
+		addrs = append(addrs, interfaceAddr{
+			ip:        ip.Unmap(),
+			temporary: f&ifaFlagTemporary != 0,
+			unusable:  f&(ifaFlagDeprecated|ifaFlagTentative) != 0,
+		})
+	}
+	return addrs, nil
+}
+
+// inet6Flags returns the flags of the IPv6 addresses assigned to the named interface. An empty map
+// is returned where /proc/net/if_inet6 is unavailable.
+func inet6Flags(name string) map[netip.Addr]int {
+	flags := make(map[netip.Addr]int)
+	f, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return flags
+	}
+	defer f.Close()
+
+	// Each line is: address, interface index, prefix length, scope, flags and interface name.
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 6 || fields[5] != name {
+			continue
+		}
+		b, err := hex.DecodeString(fields[0])
+		if err != nil {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(b)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+		flags[ip] = int(v)
+	}
+	return flags
+}
@@ -0,0 +1,95 @@
+package ipaddress
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+)
+
+// Return the public address of the requested family, skipping unsuitable addresses.
+func TestInterfaceReturnsPublicAddress(t *testing.T) {
+	tests := []struct {
+		family Family
+		want   string
+	}{
+		{IPv4, "8.8.4.4"},
+		{IPv6, "2606:4700::10"},
+	}
+	for _, tt := range tests {
+		h := newTestInterfaceHandler(tt.family,
+			interfaceAddr{ip: netip.MustParseAddr("127.0.0.1")},
+			interfaceAddr{ip: netip.MustParseAddr("192.168.1.2")},
+			interfaceAddr{ip: netip.MustParseAddr("169.254.0.5")},
+			interfaceAddr{ip: netip.MustParseAddr("100.64.0.1")},
+			interfaceAddr{ip: netip.MustParseAddr("203.0.113.7")},
+			interfaceAddr{ip: netip.MustParseAddr("8.8.4.4")},
+			interfaceAddr{ip: netip.MustParseAddr("fe80::1")},
+			interfaceAddr{ip: netip.MustParseAddr("fd00::1")},
+			interfaceAddr{ip: netip.MustParseAddr("2001:db8:1::10")},
+			interfaceAddr{ip: netip.MustParseAddr("2606:4700::1"), temporary: true},
+			interfaceAddr{ip: netip.MustParseAddr("2606:4700::2"), unusable: true},
+			interfaceAddr{ip: netip.MustParseAddr("2606:4700::10")},
+		)
+
+		got, err := h.GetCurrent(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got.String() != tt.want {
+			t.Errorf("Got: %v; want: %v", got, tt.want)
+		}
+	}
+}
+
+// The same address is chosen regardless of the order in which they are listed.
+func TestInterfacePicksStableAddress(t *testing.T) {
+	a := interfaceAddr{ip: netip.MustParseAddr("2606:4700::20")}
+	b := interfaceAddr{ip: netip.MustParseAddr("2606:4700::10")}
+
+	for _, h := range []*InterfaceIPAddressHandler{
+		newTestInterfaceHandler(IPv6, a, b),
+		newTestInterfaceHandler(IPv6, b, a),
+	} {
+		got, err := h.GetCurrent(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != b.ip {
+			t.Errorf("Got: %v; want: %v", got, b.ip)
+		}
+	}
+}
+
+// CGNAT and other non-public addresses are only used if private addresses are allowed.
+func TestInterfaceAllowsPrivateAddressOnlyIfEnabled(t *testing.T) {
+	cgnat := interfaceAddr{ip: netip.MustParseAddr("100.64.0.1")}
+
+	if _, err := newTestInterfaceHandler(IPv4, cgnat).GetCurrent(context.Background()); err == nil {
+		t.Error("Expected error for CGNAT address; got nil")
+	}
+
+	h := newTestInterfaceHandler(IPv4, cgnat)
+	h.allowPrivate = true
+	got, err := h.GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != cgnat.ip {
+		t.Errorf("Got: %v; want: %v", got, cgnat.ip)
+	}
+}
+
+// Return an error if the interface has no suitable address.
+func TestInterfaceErrorIfNoAddress(t *testing.T) {
+	h := newTestInterfaceHandler(IPv6, interfaceAddr{ip: netip.MustParseAddr("fe80::1")})
+
+	if _, err := h.GetCurrent(context.Background()); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+func newTestInterfaceHandler(f Family, addrs ...interfaceAddr) *InterfaceIPAddressHandler {
+	h := NewInterfaceIPAddressHandler("eth0", f, false)
+	h.addrs = func(string) ([]interfaceAddr, error) { return addrs, nil }
+	return h
+}
@@ -1,7 +1,40 @@
 package ipaddress
 
-import "net/netip"
+import (
+	"context"
+	"net/netip"
+)
 
+// IPAddressHandler detects the current IP address. The context bounds every request made while
+// doing so.
 type IPAddressHandler interface {
-	GetCurrent() (netip.Addr, error)
+	GetCurrent(context.Context) (netip.Addr, error)
+}
+
+// Family is an IP address family.
+type Family int
+
+const (
+	IPv4 Family = iota
+	IPv6
+)
+
+func (f Family) String() string {
+	if f == IPv6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// MarshalText implements encoding.TextMarshaler, so the family is written by name in structured logs.
+func (f Family) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// Contains reports whether ip belongs to the family.
+func (f Family) Contains(ip netip.Addr) bool {
+	if f == IPv6 {
+		return ip.Is6()
+	}
+	return ip.Is4()
 }
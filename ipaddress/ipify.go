@@ -1,37 +1,105 @@
 package ipaddress
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/netip"
+	"strings"
+
+	"github.com/bhorvath/ddclient/retry"
+)
+
+const (
+	// IpifyIPv4URL is the ipify endpoint which only responds over IPv4.
+	IpifyIPv4URL = "https://api.ipify.org"
+	// IpifyIPv6URL is the ipify endpoint which only responds over IPv6.
+	IpifyIPv6URL = "https://api6.ipify.org"
+	// maxResponseSize is the largest response accepted. Anything bigger is not a bare IP address,
+	// e.g. a captive portal page.
+	maxResponseSize = 64
 )
 
+// nonPublicPrefixes are ranges which are not private in the sense of netip.Addr.IsPrivate, but
+// which are nevertheless never the public address of a client.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation (TEST-NET-3)
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+}
+
+// IpifyIPAddressHandler retrieves the current IP address from ipify, or any other web service which
+// responds with the address as plain text.
 type IpifyIPAddressHandler struct {
-	baseURL string
+	baseURL      string
+	allowPrivate bool
+	client       *http.Client
 }
 
-func NewIpifyIPAddressHandler(baseURL string) *IpifyIPAddressHandler {
-	return &IpifyIPAddressHandler{baseURL: baseURL}
+// NewIpifyIPAddressHandler returns a handler for the service at baseURL, contacted using client. If
+// client is nil then retry.DefaultClient is used. Unless allowPrivate is set, addresses which cannot
+// be the public address of the client are refused.
+func NewIpifyIPAddressHandler(client *http.Client, baseURL string, allowPrivate bool) *IpifyIPAddressHandler {
+	if client == nil {
+		client = retry.DefaultClient
+	}
+	return &IpifyIPAddressHandler{baseURL: baseURL, allowPrivate: allowPrivate, client: client}
 }
 
 // GetCurrent returns the current public IP address of the client.
-func (h *IpifyIPAddressHandler) GetCurrent() (netip.Addr, error) {
-	res, err := http.Get(h.baseURL)
+func (h *IpifyIPAddressHandler) GetCurrent(ctx context.Context) (netip.Addr, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	res, err := h.client.Do(req)
 	if err != nil {
 		return netip.Addr{}, err
 	}
+	defer res.Body.Close()
 
-	resBody, err := io.ReadAll(res.Body)
+	statusOK := res.StatusCode >= 200 && res.StatusCode < 300
+	if !statusOK {
+		return netip.Addr{}, fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize+1))
 
 	if err != nil {
 		return netip.Addr{}, err
 	}
+	if len(resBody) > maxResponseSize {
+		return netip.Addr{}, errors.New("response is too large to be an IP address")
+	}
 
-	ip, err := netip.ParseAddr(string(resBody))
+	ip, err := netip.ParseAddr(strings.TrimSpace(string(resBody)))
 
 	if err != nil {
 		return netip.Addr{}, err
 	}
+	if !h.allowPrivate {
+		if err := checkPublic(ip); err != nil {
+			return netip.Addr{}, err
+		}
+	}
 
 	return ip, nil
 }
+
+// checkPublic returns an error if ip is not a publicly routable unicast address.
+func checkPublic(ip netip.Addr) error {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("%v is not a public address", ip)
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return fmt.Errorf("%v is not a public address", ip)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package ipaddress
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/bhorvath/ddclient/retry"
 )
 
 // Return the current public IP address of the client
@@ -12,27 +16,92 @@ func TestReturnCurrentIPAddress(t *testing.T) {
 	m := NewMockIpifyAPI()
 	m.setupRoutes()
 	defer m.svr.Close()
-	h := NewIpifyIPAddressHandler(m.svr.URL)
+	h := NewIpifyIPAddressHandler(nil, m.svr.URL, false)
 
-	got, err := h.GetCurrent()
+	got, err := h.GetCurrent(context.Background())
 	if err != nil {
 		t.Errorf("Encountered error: %v", err)
 	}
-	want := "10.0.0.1"
+	want := "1.2.3.4"
 	if got.String() != want {
 		t.Errorf("Got: %v; want: %v", got, want)
 	}
 
 }
 
+// Surrounding whitespace, such as the trailing newline sent by some services, is ignored.
+func TestTrimsWhitespace(t *testing.T) {
+	m := NewMockIpifyAPI()
+	m.response = " 1.2.3.4\n"
+	m.setupRoutes()
+	defer m.svr.Close()
+	h := NewIpifyIPAddressHandler(nil, m.svr.URL, false)
+
+	got, err := h.GetCurrent(context.Background())
+	if err != nil {
+		t.Errorf("Encountered error: %v", err)
+	}
+	if got.String() != "1.2.3.4" {
+		t.Errorf("Got: %v; want: 1.2.3.4", got)
+	}
+}
+
+// Addresses which cannot be public are refused unless explicitly allowed.
+func TestRejectsNonPublicAddresses(t *testing.T) {
+	for _, addr := range []string{
+		"10.0.0.1", "172.16.0.1", "192.168.1.1", "127.0.0.1", "100.64.0.1", "169.254.1.1",
+		"192.0.2.1", "198.51.100.1", "203.0.113.1", "0.0.0.0",
+		"::1", "fe80::1", "fd00::1", "2001:db8::1", "::ffff:10.0.0.1",
+	} {
+		m := NewMockIpifyAPI()
+		m.response = addr
+		m.setupRoutes()
+
+		if _, err := NewIpifyIPAddressHandler(nil, m.svr.URL, false).GetCurrent(context.Background()); err == nil {
+			t.Errorf("Expected error for %v; got nil", addr)
+		}
+		if _, err := NewIpifyIPAddressHandler(nil, m.svr.URL, true).GetCurrent(context.Background()); err != nil {
+			t.Errorf("Unexpected error for %v when allowed: %v", addr, err)
+		}
+		m.svr.Close()
+	}
+}
+
+// Unsuccessful responses, such as a captive portal redirecting elsewhere, are refused.
+func TestErrorOnUnsuccessfulStatus(t *testing.T) {
+	m := NewMockIpifyAPI()
+	m.status = http.StatusServiceUnavailable
+	m.setupRoutes()
+	defer m.svr.Close()
+	h := NewIpifyIPAddressHandler(retry.NewClient(retry.Policy{MaxAttempts: 1}), m.svr.URL, false)
+
+	if _, err := h.GetCurrent(context.Background()); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Responses too large to be an IP address are refused without being read in full.
+func TestErrorOnLargeResponse(t *testing.T) {
+	m := NewMockIpifyAPI()
+	m.response = "1.2.3.4" + strings.Repeat(" ", 1<<20)
+	m.setupRoutes()
+	defer m.svr.Close()
+	h := NewIpifyIPAddressHandler(nil, m.svr.URL, false)
+
+	if _, err := h.GetCurrent(context.Background()); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
 type MockIpifyAPI struct {
 	svr      *httptest.Server
 	response string
+	status   int
 	calls    int
 }
 
 func NewMockIpifyAPI() *MockIpifyAPI {
-	return &MockIpifyAPI{response: "10.0.0.1"}
+	return &MockIpifyAPI{response: "1.2.3.4", status: http.StatusOK}
 }
 
 func (m *MockIpifyAPI) setupRoutes() {
@@ -40,7 +109,8 @@ func (m *MockIpifyAPI) setupRoutes() {
 	svr := httptest.NewServer(mux)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		m.calls++
-		fmt.Fprintf(w, m.response)
+		w.WriteHeader(m.status)
+		fmt.Fprint(w, m.response)
 	})
 	m.svr = svr
 }
@@ -1,6 +1,11 @@
 package ipaddress
 
-import "net/netip"
+import (
+	"context"
+	"net/netip"
+)
+
+var _ IPAddressHandler = (*MockIPAddressHandler)(nil)
 
 type MockIPAddressHandler struct{}
 
@@ -8,6 +13,6 @@ func NewMockIPAddressHandler() *MockIPAddressHandler {
 	return &MockIPAddressHandler{}
 }
 
-func (h *MockIPAddressHandler) GetCurrent() (netip.Addr, error) {
+func (h *MockIPAddressHandler) GetCurrent(ctx context.Context) (netip.Addr, error) {
 	return netip.ParseAddr("127.0.0.1")
 }
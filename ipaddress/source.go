@@ -0,0 +1,71 @@
+package ipaddress
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// webSources maps the names of well known web services to the URLs returning the current IPv4 and
+// IPv6 address respectively. An empty URL means the service cannot be relied on for that family;
+// ifconfig.me answers over either protocol, so returns an IPv4 address to dual-stack hosts.
+var webSources = map[string][2]string{
+	"ipify":       {IpifyIPv4URL, IpifyIPv6URL},
+	"icanhazip":   {"https://ipv4.icanhazip.com", "https://ipv6.icanhazip.com"},
+	"ifconfig.me": {"https://ifconfig.me/ip", ""},
+}
+
+const (
+	// interfacePrefix precedes the name of a network interface from which to read the address.
+	interfacePrefix = "interface:"
+	// upnpSource asks the router for its WAN address. It may be followed by ":" and the address of
+	// the router to use for NAT-PMP requests.
+	upnpSource = "upnp"
+)
+
+// SourceOptions adjust the behaviour of the handlers returned by NewSource.
+type SourceOptions struct {
+	// AllowPrivate accepts private, CGNAT, documentation and other non-public addresses from web
+	// services, network interfaces and the router, e.g. for lab setups.
+	AllowPrivate bool
+	// Client is used to contact web services. If nil, retry.DefaultClient is used. It is not used to
+	// contact the router, which is always reached directly.
+	Client *http.Client
+}
+
+// NewSource returns an IPAddressHandler which detects the current address of the given family from
+// the named source. The source is either the name of a well known web service (ipify, icanhazip or,
+// for IPv4 only, ifconfig.me), the URL of any service which responds with the address as plain
+// text, or the name of a local network interface prefixed with "interface:", e.g. "interface:eth0".
+// The source "upnp" asks the router for its WAN address using UPnP IGD or NAT-PMP, and may be
+// followed by the address of the router, e.g. "upnp:192.168.1.1".
+func NewSource(source string, f Family, o SourceOptions) (IPAddressHandler, error) {
+	if name, ok := strings.CutPrefix(source, interfacePrefix); ok && name != "" {
+		return NewInterfaceIPAddressHandler(name, f, o.AllowPrivate), nil
+	}
+	if source == upnpSource || strings.HasPrefix(source, upnpSource+":") {
+		if f != IPv4 {
+			return nil, fmt.Errorf("IP address source %q only provides IPv4 addresses", source)
+		}
+		var gw netip.Addr
+		if s, ok := strings.CutPrefix(source, upnpSource+":"); ok {
+			var err error
+			if gw, err = netip.ParseAddr(s); err != nil || !gw.Is4() {
+				return nil, fmt.Errorf("invalid gateway address in IP address source %q", source)
+			}
+		}
+		return NewUPnPIPAddressHandler(gw, o.AllowPrivate), nil
+	}
+	if urls, ok := webSources[source]; ok {
+		if urls[f] == "" {
+			return nil, fmt.Errorf("IP address source %q only provides IPv4 addresses", source)
+		}
+		return NewIpifyIPAddressHandler(o.Client, urls[f], o.AllowPrivate), nil
+	}
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return NewIpifyIPAddressHandler(o.Client, source, o.AllowPrivate), nil
+	}
+	return nil, fmt.Errorf("unknown IP address source %q", source)
+}
@@ -0,0 +1,318 @@
+package ipaddress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// SSDPAddr is the multicast address to which UPnP discovery requests are sent.
+	SSDPAddr = "239.255.255.250:1900"
+	// NATPMPPort is the port on which gateways listen for NAT-PMP (and PCP) requests.
+	NATPMPPort = 5351
+	// upnpTimeout bounds each step of querying the gateway.
+	upnpTimeout = 3 * time.Second
+	igdDevice   = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+)
+
+// wanServices lists the UPnP services which can report the external IP address, in order of
+// preference.
+var wanServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// UPnPIPAddressHandler retrieves the current IPv4 address by asking the local router for its WAN
+// address. UPnP IGD is tried first, falling back to NAT-PMP. PCP gateways are also supported as
+// they accept NAT-PMP requests for backward compatibility.
+type UPnPIPAddressHandler struct {
+	ssdpAddr     string
+	gateway      netip.Addr
+	natPMPPort   uint16
+	timeout      time.Duration
+	allowPrivate bool
+	client       *http.Client
+}
+
+// NewUPnPIPAddressHandler returns a handler which discovers the router using SSDP. If gateway is
+// not valid then the default gateway of the host is used for NAT-PMP requests. Unless allowPrivate
+// is set, addresses which cannot be public are refused, such as those of a router behind another
+// NAT.
+func NewUPnPIPAddressHandler(gateway netip.Addr, allowPrivate bool) *UPnPIPAddressHandler {
+	return &UPnPIPAddressHandler{
+		ssdpAddr:     SSDPAddr,
+		gateway:      gateway,
+		natPMPPort:   NATPMPPort,
+		timeout:      upnpTimeout,
+		allowPrivate: allowPrivate,
+		client:       &http.Client{Timeout: upnpTimeout},
+	}
+}
+
+// GetCurrent returns the external IPv4 address reported by the router.
+func (h *UPnPIPAddressHandler) GetCurrent(ctx context.Context) (netip.Addr, error) {
+	ip, upnpErr := h.getUPnP(ctx)
+	if upnpErr == nil {
+		if upnpErr = h.check(ip); upnpErr == nil {
+			return ip, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return netip.Addr{}, err
+	}
+	ip, pmpErr := h.getNATPMP(ctx)
+	if pmpErr == nil {
+		if pmpErr = h.check(ip); pmpErr == nil {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, errors.Join(fmt.Errorf("upnp: %w", upnpErr), fmt.Errorf("nat-pmp: %w", pmpErr))
+}
+
+// check returns an error if ip cannot be used as the external address. Routers commonly report
+// 0.0.0.0 while their WAN connection is down.
+func (h *UPnPIPAddressHandler) check(ip netip.Addr) error {
+	if ip.IsUnspecified() {
+		return errors.New("gateway has no external address")
+	}
+	if !h.allowPrivate {
+		return checkPublic(ip)
+	}
+	return nil
+}
+
+func (h *UPnPIPAddressHandler) getUPnP(ctx context.Context) (netip.Addr, error) {
+	location, err := h.discover(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	controlURL, service, err := h.findControlURL(ctx, location)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return h.getExternalIPAddress(ctx, controlURL, service)
+}
+
+// discover sends an SSDP search for internet gateway devices and returns the location of the
+// description of the first device to respond.
+func (h *UPnPIPAddressHandler) discover(ctx context.Context) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp4", h.ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + SSDPAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + igdDevice + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(req), addr); err != nil {
+		return "", err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(h.timeout))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return "", fmt.Errorf("no gateway found: %w", err)
+		}
+		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		res.Body.Close()
+		if loc := res.Header.Get("Location"); res.StatusCode == http.StatusOK && loc != "" {
+			return loc, nil
+		}
+	}
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// findControlURL retrieves the device description at location and returns the absolute control
+// URL and type of the service reporting the external IP address.
+func (h *UPnPIPAddressHandler) findControlURL(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to retrieve device description; status %s", res.Status)
+	}
+
+	var desc struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&desc); err != nil {
+		return "", "", err
+	}
+
+	services := make(map[string]string)
+	collectServices(desc.Device, services)
+	for _, st := range wanServices {
+		control, ok := services[st]
+		if !ok {
+			continue
+		}
+		base := location
+		if desc.URLBase != "" {
+			base = desc.URLBase
+		}
+		u, err := url.Parse(base)
+		if err != nil {
+			return "", "", err
+		}
+		c, err := u.Parse(control)
+		if err != nil {
+			return "", "", err
+		}
+		return c.String(), st, nil
+	}
+	return "", "", errors.New("gateway does not provide a WAN connection service")
+}
+
+// collectServices records the control URL of every service provided by d and its sub devices.
+func collectServices(d upnpDevice, services map[string]string) {
+	for _, s := range d.Services {
+		services[s.ServiceType] = s.ControlURL
+	}
+	for _, sub := range d.Devices {
+		collectServices(sub, services)
+	}
+}
+
+func (h *UPnPIPAddressHandler) getExternalIPAddress(ctx context.Context, controlURL string, service string) (netip.Addr, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + service + `"/></s:Body></s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, strings.NewReader(body))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+service+`#GetExternalIPAddress"`)
+	res, err := h.client.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		resBody, _ := io.ReadAll(res.Body)
+		return netip.Addr{}, fmt.Errorf("GetExternalIPAddress failed; %s", resBody)
+	}
+
+	var env struct {
+		Address string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&env); err != nil {
+		return netip.Addr{}, err
+	}
+	return netip.ParseAddr(strings.TrimSpace(env.Address))
+}
+
+// getNATPMP sends a NAT-PMP external address request to the gateway.
+func (h *UPnPIPAddressHandler) getNATPMP(ctx context.Context) (netip.Addr, error) {
+	gw := h.gateway
+	if !gw.IsValid() {
+		var err error
+		if gw, err = defaultGateway(); err != nil {
+			return netip.Addr{}, err
+		}
+	}
+
+	conn, err := net.DialUDP("udp4", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(gw, h.natPMPPort)))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Request: version 0, opcode 0 (external address).
+	if _, err := conn.Write([]byte{0, 0}); err != nil {
+		return netip.Addr{}, err
+	}
+	conn.SetReadDeadline(time.Now().Add(h.timeout))
+	res := make([]byte, 16)
+	n, err := conn.Read(res)
+	if ctx.Err() != nil {
+		return netip.Addr{}, ctx.Err()
+	}
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	// Response: version, opcode (128 + request opcode), result code, epoch and address.
+	if n < 12 || res[0] != 0 || res[1] != 128 {
+		return netip.Addr{}, errors.New("invalid response from gateway")
+	}
+	if code := binary.BigEndian.Uint16(res[2:4]); code != 0 {
+		return netip.Addr{}, fmt.Errorf("gateway responded with result code %d", code)
+	}
+	return netip.AddrFrom4([4]byte(res[8:12])), nil
+}
+
+// defaultGateway returns the IPv4 default gateway of the host, read from /proc/net/route. It is
+// only supported on Linux.
+func defaultGateway() (netip.Addr, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("cannot determine default gateway: %w", err)
+	}
+	defer f.Close()
+
+	// Columns are interface, destination, gateway, ... with addresses in little endian hex.
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 || fields[1] != "00000000" || fields[2] == "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		return netip.AddrFrom4([4]byte{b[3], b[2], b[1], b[0]}), nil
+	}
+	return netip.Addr{}, errors.New("cannot determine default gateway: no default route")
+}
@@ -0,0 +1,227 @@
+package ipaddress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return the external address reported by the gateway's WAN connection service.
+func TestUPnPReturnsExternalAddress(t *testing.T) {
+	m := NewMockGateway()
+	m.setupRoutes(t)
+	h := m.handler()
+
+	got, err := h.GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "203.0.113.7" {
+		t.Errorf("Got: %v; want: 203.0.113.7", got)
+	}
+	if m.soapAction != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+		t.Errorf("Got SOAPAction: %v", m.soapAction)
+	}
+}
+
+// Fall back to NAT-PMP if the gateway does not respond to UPnP discovery.
+func TestUPnPFallsBackToNATPMP(t *testing.T) {
+	m := NewMockGateway()
+	m.ssdpSilent = true
+	m.setupRoutes(t)
+	h := m.handler()
+
+	got, err := h.GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "198.51.100.9" {
+		t.Errorf("Got: %v; want: 198.51.100.9", got)
+	}
+}
+
+// Return an error if neither UPnP nor NAT-PMP provides an address.
+func TestUPnPErrorIfGatewayUnavailable(t *testing.T) {
+	m := NewMockGateway()
+	m.ssdpSilent = true
+	m.natPMPResult = 3
+	m.setupRoutes(t)
+	h := m.handler()
+
+	if _, err := h.GetCurrent(context.Background()); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Fall back to NAT-PMP if UPnP reports 0.0.0.0, as routers do while the WAN link is down, and
+// return an error if NAT-PMP does too.
+func TestUPnPRefusesUnspecifiedAddress(t *testing.T) {
+	m := NewMockGateway()
+	m.upnpAddress = "0.0.0.0"
+	m.setupRoutes(t)
+
+	got, err := m.handler().GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "198.51.100.9" {
+		t.Errorf("Got: %v; want: 198.51.100.9", got)
+	}
+
+	m = NewMockGateway()
+	m.upnpAddress = "0.0.0.0"
+	m.natPMPAddress = [4]byte{}
+	m.setupRoutes(t)
+	if _, err := m.handler().GetCurrent(context.Background()); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Return an error if the router reports a private or CGNAT address, e.g. behind double NAT,
+// unless private addresses are allowed.
+func TestUPnPRefusesPrivateAddress(t *testing.T) {
+	m := NewMockGateway()
+	m.upnpAddress = "192.168.1.2"
+	m.natPMPAddress = [4]byte{100, 64, 0, 1}
+	m.allowPrivate = false
+	m.setupRoutes(t)
+
+	if _, err := m.handler().GetCurrent(context.Background()); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("Expected public address error; got: %v", err)
+	}
+
+	m.allowPrivate = true
+	got, err := m.handler().GetCurrent(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "192.168.1.2" {
+		t.Errorf("Got: %v; want: 192.168.1.2", got)
+	}
+}
+
+// MockGateway imitates a router answering SSDP discovery, serving a device description and SOAP
+// control endpoint, and answering NAT-PMP requests. Each listens on the loopback interface.
+type MockGateway struct {
+	ssdp, natPMP *net.UDPConn
+	svr          *httptest.Server
+	ssdpSilent   bool
+	natPMPResult uint16
+	soapAction   string
+	// upnpAddress and natPMPAddress are the external addresses reported by each protocol.
+	upnpAddress   string
+	natPMPAddress [4]byte
+	allowPrivate  bool
+}
+
+const deviceDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+const externalIPResponse = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>%s</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`
+
+func NewMockGateway() *MockGateway {
+	return &MockGateway{upnpAddress: "203.0.113.7", natPMPAddress: [4]byte{198, 51, 100, 9}, allowPrivate: true}
+}
+
+func (m *MockGateway) setupRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, deviceDescription)
+	})
+	mux.HandleFunc("POST /ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		m.soapAction = r.Header.Get("SOAPAction")
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprintf(w, externalIPResponse, m.upnpAddress)
+	})
+	m.svr = httptest.NewServer(mux)
+	t.Cleanup(m.svr.Close)
+
+	m.ssdp = listenUDP(t)
+	go m.serveSSDP()
+	m.natPMP = listenUDP(t)
+	go m.serveNATPMP()
+}
+
+func (m *MockGateway) handler() *UPnPIPAddressHandler {
+	h := NewUPnPIPAddressHandler(netip.MustParseAddr("127.0.0.1"), m.allowPrivate)
+	h.ssdpAddr = m.ssdp.LocalAddr().String()
+	h.natPMPPort = uint16(m.natPMP.LocalAddr().(*net.UDPAddr).Port)
+	h.timeout = 200 * time.Millisecond
+	return h
+}
+
+func (m *MockGateway) serveSSDP() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := m.ssdp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if m.ssdpSilent || !strings.HasPrefix(string(buf[:n]), "M-SEARCH") {
+			continue
+		}
+		res := "HTTP/1.1 200 OK\r\n" +
+			"ST: " + igdDevice + "\r\n" +
+			"LOCATION: " + m.svr.URL + "/rootDesc.xml\r\n\r\n"
+		m.ssdp.WriteTo([]byte(res), addr)
+	}
+}
+
+func (m *MockGateway) serveNATPMP() {
+	buf := make([]byte, 16)
+	for {
+		n, addr, err := m.natPMP.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n != 2 || buf[0] != 0 || buf[1] != 0 {
+			continue
+		}
+		res := []byte{0, 128, byte(m.natPMPResult >> 8), byte(m.natPMPResult), 0, 0, 0, 1}
+		res = append(res, m.natPMPAddress[:]...)
+		m.natPMP.WriteTo(res, addr)
+	}
+}
+
+func listenUDP(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
@@ -1,49 +1,104 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/bhorvath/ddclient/config"
 	"github.com/bhorvath/ddclient/dns"
+	"github.com/bhorvath/ddclient/httpclient"
 	"github.com/bhorvath/ddclient/ipaddress"
+	"github.com/bhorvath/ddclient/metrics"
+	"github.com/bhorvath/ddclient/notify"
+	"github.com/bhorvath/ddclient/retry"
+	"github.com/bhorvath/ddclient/state"
 )
 
+// exitChangesPending is the exit code of a dry run which found records that would be changed.
+const exitChangesPending = 2
+
 func main() {
 	args := config.ParseArgs()
+	if args.DryRun && args.Daemon {
+		fatal("--dry-run cannot be used with --daemon")
+	}
 	cfgS := config.NewService(args)
+	if args.Config != nil && args.Config.Validate != nil {
+		os.Exit(validate(cfgS, os.Stdout))
+	}
 	checkSave(args, cfgS)
 	cfg := prepareConfigs(cfgS)
+	logger := prepareLogger(cfg.Logging)
+	logWarnings(logger, cfgS.Warnings())
 
-	ih := ipaddress.NewIpifyIPAddressHandler("https://api.ipify.org")
-	dh, err := dns.NewPorkbunDNSHandler("https://api.porkbun.com", cfg)
-	if err != nil {
-		fmt.Println("Error setting up DNS handler:", err)
-		os.Exit(1)
+	client := prepareHTTPClient(cfg)
+	var m *metrics.Metrics
+	if args.Daemon && cfg.Metrics.Address != "" {
+		m = metrics.New()
 	}
+	u := &updater{
+		ipHandlers:     prepareIPAddressHandlers(cfg, client),
+		targets:        prepareTargets(cfg, client, logger, m, args.DryRun),
+		state:          prepareState(cfg),
+		verifyInterval: time.Duration(cfg.VerifyInterval),
+		runTimeout:     time.Duration(cfg.RunTimeout),
+		dryRun:         args.DryRun,
+		logger:         logger,
+		notifier:       prepareNotifier(cfg, client),
+		metrics:        m,
+	}
+	u.restoreState()
 
-	ip, err := ih.GetCurrent()
-	if err != nil {
-		fmt.Println("Error getting current IP address:", err)
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if args.Daemon {
+		if m != nil {
+			addr, err := serveMetrics(ctx, cfg.Metrics.Address, m, logger)
+			if err != nil {
+				fatal("Error serving metrics", "error", err)
+			}
+			logger.Info("Serving metrics", "address", addr.String())
+		}
+		runDaemon(ctx, u, time.Duration(cfg.Interval))
+		return
 	}
-	fmt.Println("Current IP address:", ip)
 
-	err = dh.Update(ip)
+	changes, err := u.update(ctx)
 	if err != nil {
-		fmt.Println("Error updating DNS entry:", err)
-		os.Exit(1)
+		fatal(err.Error())
 	}
+	if args.DryRun && changes > 0 {
+		logger.Info("Dry run found records to change", "changes", changes)
+		os.Exit(exitChangesPending)
+	}
+}
+
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func checkSave(args *config.Args, cfgS config.Service) {
 	// If saving config then no other action is taken
 	if args.Save {
-		fmt.Println("Saving configuration to file")
-		if err := cfgS.SaveConfig(); err != nil {
-			fmt.Println("Error encountered while saving configuration:",
-				err.Error())
-			os.Exit(1)
+		// The config is not built when saving, so only logging options given as args apply
+		l := args.Logging
+		if l.Level == "" {
+			l.Level = config.DefaultLogLevel
+		}
+		logger := prepareLogger(l)
+		logger.Info("Saving configuration to file", "file", cfgS.ConfigFilePath())
+		err := cfgS.SaveConfig()
+		logWarnings(logger, cfgS.Warnings())
+		if err != nil {
+			fatal("Error encountered while saving configuration", "error", err)
 		}
 		os.Exit(0)
 	}
@@ -52,9 +107,135 @@ func checkSave(args *config.Args, cfgS config.Service) {
 func prepareConfigs(cfgS config.Service) *config.App {
 	cfg, err := cfgS.BuildConfig()
 	if err != nil {
-		fmt.Println("Error encountered while configuring application:",
-			err.Error())
-		os.Exit(1)
+		fatal("Error encountered while configuring application", "error", err)
 	}
 	return cfg
 }
+
+// prepareLogger sets up the configured logger and makes it the default, so that messages logged
+// by other packages are formatted in the same way.
+func prepareLogger(cfg config.Logging) *slog.Logger {
+	l, err := newLogger(os.Stderr, cfg)
+	if err != nil {
+		fatal("Error setting up logging", "error", err)
+	}
+	slog.SetDefault(l)
+	return l
+}
+
+// logWarnings logs each of the warnings found while handling the configuration.
+func logWarnings(logger *slog.Logger, warnings []config.Warning) {
+	for _, w := range warnings {
+		logger.Warn(w.Msg, w.Args...)
+	}
+}
+
+func prepareHTTPClient(cfg *config.App) *http.Client {
+	c, err := newHTTPClient(cfg)
+	if err != nil {
+		fatal("Error setting up HTTP client", "error", err)
+	}
+	return c
+}
+
+// newHTTPClient returns the configured HTTP client.
+func newHTTPClient(cfg *config.App) (*http.Client, error) {
+	return httpclient.New(httpclient.Options{
+		Timeout:   time.Duration(cfg.HTTP.Timeout),
+		Proxy:     cfg.HTTP.Proxy,
+		CABundle:  cfg.HTTP.CABundle,
+		IPVersion: cfg.HTTP.IPVersion,
+		Retry: retry.Policy{
+			MaxAttempts: cfg.HTTP.MaxAttempts,
+			BaseDelay:   retry.DefaultPolicy.BaseDelay,
+			MaxDelay:    retry.DefaultPolicy.MaxDelay,
+		},
+	})
+}
+
+func prepareTargets(cfg *config.App, client *http.Client, logger *slog.Logger, m *metrics.Metrics, dryRun bool) []*target {
+	targets, err := newTargets(cfg, client, logger, m, dryRun)
+	if err != nil {
+		fatal("Error setting up DNS handler", "error", err)
+	}
+	return targets
+}
+
+// newTargets returns a target for each record in cfg. The time taken by requests to DNS providers
+// is recorded in m, unless it is nil. No requests are made.
+func newTargets(cfg *config.App, client *http.Client, logger *slog.Logger, m *metrics.Metrics, dryRun bool) ([]*target, error) {
+	var targets []*target
+	for _, r := range cfg.AllRecords() {
+		f, err := dns.RecordFamily(r.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.FQDN(), err)
+		}
+		o := dns.Options{Record: r, Config: cfg, DryRun: dryRun, Client: client, Logger: logger}
+		if m != nil {
+			provider := cfg.ProviderFor(r)
+			o.ObserveRequest = func(d time.Duration) { m.ObserveRequestDuration(provider, d) }
+		}
+		dh, err := dns.New(o)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.FQDN(), err)
+		}
+		if r.Name == "" {
+			logger.Warn("Name not set - updating root domain record", "domain", r.Domain)
+		}
+		targets = append(targets, &target{record: r, provider: cfg.ProviderFor(r), handler: dh, family: f})
+	}
+	return targets, nil
+}
+
+func prepareIPAddressHandlers(cfg *config.App, client *http.Client) map[ipaddress.Family]ipaddress.IPAddressHandler {
+	ihs, err := newIPAddressHandlers(cfg, client)
+	if err != nil {
+		fatal("Error setting up address source", "error", err)
+	}
+	return ihs
+}
+
+// newIPAddressHandlers returns a handler for each address family which consults the configured
+// sources. No requests are made.
+func newIPAddressHandlers(cfg *config.App, client *http.Client) (map[ipaddress.Family]ipaddress.IPAddressHandler, error) {
+	sources := map[ipaddress.Family][]string{
+		ipaddress.IPv4: cfg.Detection.IPv4Sources,
+		ipaddress.IPv6: cfg.Detection.IPv6Sources,
+	}
+	opts := ipaddress.SourceOptions{AllowPrivate: cfg.Detection.AllowPrivate, Client: client}
+	ihs := make(map[ipaddress.Family]ipaddress.IPAddressHandler)
+	for f, names := range sources {
+		var handlers []ipaddress.IPAddressHandler
+		for _, n := range names {
+			h, err := ipaddress.NewSource(n, f, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", f, err)
+			}
+			handlers = append(handlers, h)
+		}
+		ihs[f] = ipaddress.NewCompositeIPAddressHandler(f, handlers, cfg.Detection.Quorum)
+	}
+	return ihs, nil
+}
+
+func prepareNotifier(cfg *config.App, client *http.Client) *notify.Dispatcher {
+	if len(cfg.Notifications) == 0 {
+		return nil
+	}
+	d, err := notify.New(cfg.Notifications, client)
+	if err != nil {
+		fatal("Error setting up notifications", "error", err)
+	}
+	return d
+}
+
+func prepareState(cfg *config.App) *state.Store {
+	if cfg.StateFile == "" {
+		return nil
+	}
+	s, err := state.Load(cfg.StateFile)
+	if err != nil {
+		fatal("Error reading state file", "file", cfg.StateFile, "error", err)
+	}
+	return s
+}
@@ -0,0 +1,282 @@
+// Package metrics records the outcome of checking the IP address and updating DNS records, and
+// exposes it in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhorvath/ddclient/dns"
+)
+
+// Stages at which a check can fail.
+const (
+	// StageDetection is the detection of the current IP address.
+	StageDetection = "detection"
+	// StageProvider is the update of a record with its DNS provider.
+	StageProvider = "provider"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the record update duration histogram. They
+// extend to a minute as an update may make several requests, each including any retries.
+var DurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// RequestDurationBuckets are the upper bounds, in seconds, of the provider request duration
+// histogram.
+var RequestDurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics holds the metrics of a running client. It is safe for concurrent use, and a nil *Metrics
+// discards everything recorded.
+type Metrics struct {
+	mu          sync.Mutex
+	lastSuccess map[recordKey]time.Time
+	currentIP   map[string]netip.Addr
+	updates     map[updateKey]uint64
+	failures    map[string]uint64
+	durations   map[string]*histogram
+	requests    map[string]*histogram
+}
+
+type recordKey struct {
+	record, recordType string
+}
+
+type updateKey struct {
+	recordKey
+	action string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// New returns an empty set of metrics.
+func New() *Metrics {
+	return &Metrics{
+		lastSuccess: make(map[recordKey]time.Time),
+		currentIP:   make(map[string]netip.Addr),
+		updates:     make(map[updateKey]uint64),
+		failures:    make(map[string]uint64),
+		durations:   make(map[string]*histogram),
+		requests:    make(map[string]*histogram),
+	}
+}
+
+// SetCurrentIP records ip as the current address of the given family.
+func (m *Metrics) SetCurrentIP(family string, ip netip.Addr) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.currentIP[family] = ip
+}
+
+// ClearCurrentIP forgets the current address of the given family, e.g. as it could not be
+// detected, so that a stale address is not exported as current.
+func (m *Metrics) ClearCurrentIP(family string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.currentIP, family)
+}
+
+// RecordUpdate records a successful update or check of a record at the given time.
+func (m *Metrics) RecordUpdate(record, recordType string, action dns.Action, at time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := recordKey{record, recordType}
+	m.lastSuccess[k] = at
+	m.updates[updateKey{k, actionLabel(action)}]++
+}
+
+// RecordFailure records a failed check at the given stage.
+func (m *Metrics) RecordFailure(stage string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[stage]++
+}
+
+// ObserveUpdateDuration records how long updating a record with the given provider took, including
+// every request made and any retries.
+func (m *Metrics) ObserveUpdateDuration(provider string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observe(m.durations, provider, DurationBuckets, d)
+}
+
+// ObserveRequestDuration records how long a single request to the given provider took. Each
+// attempt at a retried request is observed separately.
+func (m *Metrics) ObserveRequestDuration(provider string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observe(m.requests, provider, RequestDurationBuckets, d)
+}
+
+// observe adds d to the histogram of the given provider in hs, creating it with the given buckets if
+// need be.
+func observe(hs map[string]*histogram, provider string, buckets []float64, d time.Duration) {
+	h := hs[provider]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(buckets))}
+		hs[provider] = h
+	}
+	s := d.Seconds()
+	for i, b := range buckets {
+		if s <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+
+	header(b, "ddclient_last_success_timestamp_seconds", "gauge", "Unix time at which each record was last successfully updated, or confirmed with its provider or the state file.")
+	for _, k := range sortedKeys(m.lastSuccess, compareRecordKeys) {
+		sample(b, "ddclient_last_success_timestamp_seconds", float64(m.lastSuccess[k].UnixMilli())/1000, "record", k.record, "type", k.recordType)
+	}
+
+	header(b, "ddclient_current_ip_info", "gauge", "Current IP address of each family, as a label.")
+	for _, f := range sortedKeys(m.currentIP, strings.Compare) {
+		sample(b, "ddclient_current_ip_info", 1, "family", f, "ip", m.currentIP[f].String())
+	}
+
+	header(b, "ddclient_updates_total", "counter", "Successful checks of each record, by the action taken: create, update or noop.")
+	for _, k := range sortedKeys(m.updates, compareUpdateKeys) {
+		sample(b, "ddclient_updates_total", float64(m.updates[k]), "record", k.record, "type", k.recordType, "action", k.action)
+	}
+
+	header(b, "ddclient_failures_total", "counter", "Failed checks, by the stage which failed: detection or provider.")
+	for _, s := range sortedKeys(m.failures, strings.Compare) {
+		sample(b, "ddclient_failures_total", float64(m.failures[s]), "stage", s)
+	}
+
+	header(b, "ddclient_provider_request_duration_seconds", "histogram", "Time taken by each request to a DNS provider, by provider, with each attempt at a retried request counted separately.")
+	writeHistograms(b, "ddclient_provider_request_duration_seconds", m.requests, RequestDurationBuckets)
+
+	header(b, "ddclient_record_update_duration_seconds", "histogram", "Time taken to update a record with its provider, by provider, including every request and any retries.")
+	writeHistograms(b, "ddclient_record_update_duration_seconds", m.durations, DurationBuckets)
+
+	err := b.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// writeHistograms writes the samples of the named histogram for each provider in hs.
+func writeHistograms(w io.Writer, name string, hs map[string]*histogram, buckets []float64) {
+	for _, p := range sortedKeys(hs, strings.Compare) {
+		h := hs[p]
+		for i, le := range buckets {
+			sample(w, name+"_bucket", float64(h.counts[i]), "provider", p, "le", formatFloat(le))
+		}
+		sample(w, name+"_bucket", float64(h.count), "provider", p, "le", "+Inf")
+		sample(w, name+"_sum", h.sum, "provider", p)
+		sample(w, name+"_count", float64(h.count), "provider", p)
+	}
+}
+
+// actionLabel returns the label used for a in ddclient_updates_total.
+func actionLabel(a dns.Action) string {
+	if a == dns.NoChange {
+		return "noop"
+	}
+	return a.String()
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a single sample of the named metric. labels alternate between names and values.
+func sample(w io.Writer, name string, v float64, labels ...string) {
+	io.WriteString(w, name)
+	if len(labels) > 0 {
+		var l []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			l = append(l, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+		}
+		io.WriteString(w, "{"+strings.Join(l, ",")+"}")
+	}
+	io.WriteString(w, " "+formatFloat(v)+"\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// sortedKeys returns the keys of m sorted using cmp, so that metrics are written in a stable order.
+func sortedKeys[K comparable, V any](m map[K]V, cmp func(a, b K) int) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, cmp)
+	return keys
+}
+
+func compareRecordKeys(a, b recordKey) int {
+	if c := strings.Compare(a.record, b.record); c != 0 {
+		return c
+	}
+	return strings.Compare(a.recordType, b.recordType)
+}
+
+func compareUpdateKeys(a, b updateKey) int {
+	if c := compareRecordKeys(a.recordKey, b.recordKey); c != 0 {
+		return c
+	}
+	return strings.Compare(a.action, b.action)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
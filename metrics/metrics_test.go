@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/dns"
+)
+
+// Expect recorded metrics to be written in the Prometheus text format.
+func TestWritesMetrics(t *testing.T) {
+	m := New()
+	m.SetCurrentIP("IPv4", netip.MustParseAddr("10.0.0.1"))
+	m.SetCurrentIP("IPv4", netip.MustParseAddr("10.0.0.2"))
+	m.RecordUpdate("www.example.com", "A", dns.Updated, time.UnixMilli(1700000000500))
+	m.RecordUpdate("www.example.com", "A", dns.NoChange, time.UnixMilli(1700000000500))
+	m.RecordUpdate("www.example.com", "A", dns.NoChange, time.UnixMilli(1700000000500))
+	m.RecordFailure(StageDetection)
+	m.ObserveUpdateDuration("porkbun", 200*time.Millisecond)
+	m.ObserveUpdateDuration("porkbun", 3*time.Second)
+	m.ObserveRequestDuration("rfc2136", 20*time.Millisecond)
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		"# TYPE ddclient_last_success_timestamp_seconds gauge\n",
+		`ddclient_last_success_timestamp_seconds{record="www.example.com",type="A"} 1700000000.5` + "\n",
+		`ddclient_current_ip_info{family="IPv4",ip="10.0.0.2"} 1` + "\n",
+		`ddclient_updates_total{record="www.example.com",type="A",action="noop"} 2` + "\n",
+		`ddclient_updates_total{record="www.example.com",type="A",action="update"} 1` + "\n",
+		`ddclient_failures_total{stage="detection"} 1` + "\n",
+		`ddclient_record_update_duration_seconds_bucket{provider="porkbun",le="0.25"} 1` + "\n",
+		`ddclient_record_update_duration_seconds_bucket{provider="porkbun",le="5"} 2` + "\n",
+		`ddclient_record_update_duration_seconds_bucket{provider="porkbun",le="+Inf"} 2` + "\n",
+		`ddclient_record_update_duration_seconds_sum{provider="porkbun"} 3.2` + "\n",
+		`ddclient_record_update_duration_seconds_count{provider="porkbun"} 2` + "\n",
+		"# TYPE ddclient_provider_request_duration_seconds histogram\n",
+		`ddclient_provider_request_duration_seconds_bucket{provider="rfc2136",le="0.01"} 0` + "\n",
+		`ddclient_provider_request_duration_seconds_bucket{provider="rfc2136",le="0.025"} 1` + "\n",
+		`ddclient_provider_request_duration_seconds_count{provider="rfc2136"} 1` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected output to contain %q; got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "10.0.0.1") {
+		t.Errorf("Expected only the current address; got:\n%s", got)
+	}
+}
+
+// Expect label values to be escaped.
+func TestEscapesLabels(t *testing.T) {
+	m := New()
+	m.RecordUpdate(`a"b\c`, "A", dns.Created, time.Unix(0, 0))
+
+	var b strings.Builder
+	m.WriteTo(&b)
+
+	if want := `record="a\"b\\c"`; !strings.Contains(b.String(), want) {
+		t.Errorf("Expected output to contain %q; got:\n%s", want, b.String())
+	}
+}
+
+// Expect the metrics to be served over HTTP.
+func TestServesMetrics(t *testing.T) {
+	m := New()
+	m.RecordFailure(StageProvider)
+	rec := httptest.NewRecorder()
+
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Got content type: %v; want: text/plain", ct)
+	}
+	if want := `ddclient_failures_total{stage="provider"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected output to contain %q; got:\n%s", want, rec.Body.String())
+	}
+}
+
+// Expect a nil *Metrics to discard what is recorded.
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.SetCurrentIP("IPv4", netip.MustParseAddr("10.0.0.1"))
+	m.ClearCurrentIP("IPv4")
+	m.RecordUpdate("www.example.com", "A", dns.Created, time.Now())
+	m.RecordFailure(StageProvider)
+	m.ObserveUpdateDuration("porkbun", time.Second)
+	m.ObserveRequestDuration("porkbun", time.Second)
+}
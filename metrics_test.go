@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/metrics"
+)
+
+// Expect metrics to be served until the context is cancelled.
+func TestServesMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := metrics.New()
+	m.RecordFailure(metrics.StageDetection)
+
+	addr, err := serveMetrics(ctx, "127.0.0.1:0", m, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := http.Get("http://" + addr.String() + "/metrics")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if want := `ddclient_failures_total{stage="detection"} 1`; !strings.Contains(string(body), want) {
+		t.Errorf("Expected metrics to contain %q; got:\n%s", want, body)
+	}
+
+	cancel()
+	for i := 0; ; i++ {
+		res, err := http.Get("http://" + addr.String() + "/metrics")
+		if err != nil {
+			break
+		}
+		res.Body.Close()
+		if i == 100 {
+			t.Fatal("Expected error after shutdown; got nil")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Expect updates and failures to be recorded in the metrics.
+func TestUpdateRecordsMetrics(t *testing.T) {
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	ok := &target{record: config.Record{Domain: "one.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{}}
+	failing := &target{record: config.Record{Domain: "two.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{failures: 1}}
+	u := newTestUpdater(ih, ok, failing)
+	u.metrics = metrics.New()
+
+	u.update(context.Background())
+
+	var b strings.Builder
+	u.metrics.WriteTo(&b)
+	for _, want := range []string{
+		`ddclient_current_ip_info{family="IPv4",ip="10.0.0.1"} 1`,
+		`ddclient_last_success_timestamp_seconds{record="one.com",type="A"}`,
+		`ddclient_updates_total{record="one.com",type="A",action="update"} 1`,
+		`ddclient_failures_total{stage="provider"} 1`,
+		`ddclient_record_update_duration_seconds_count{provider="porkbun"} 2`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected metrics to contain %q; got:\n%s", want, b.String())
+		}
+	}
+	if strings.Contains(b.String(), `record="two.com"`) {
+		t.Errorf("Expected no success recorded for failed record; got:\n%s", b.String())
+	}
+}
+
+// Expect a record skipped because it already holds the current address to count as a successful
+// check.
+func TestUpdateRecordsMetricsForCachedRecords(t *testing.T) {
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	cached := &target{record: config.Record{Domain: "one.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{},
+		last: netip.MustParseAddr("10.0.0.1"), verified: time.Now()}
+	u := newTestUpdater(ih, cached)
+	u.verifyInterval = time.Hour
+	u.metrics = metrics.New()
+
+	u.update(context.Background())
+
+	var b strings.Builder
+	u.metrics.WriteTo(&b)
+	for _, want := range []string{
+		`ddclient_last_success_timestamp_seconds{record="one.com",type="A"}`,
+		`ddclient_updates_total{record="one.com",type="A",action="noop"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected metrics to contain %q; got:\n%s", want, b.String())
+		}
+	}
+	if n := len(cached.handler.(*fakeDNSHandler).updates); n != 0 {
+		t.Errorf("Got update calls: %v; want: 0", n)
+	}
+}
+
+// Expect the current address to no longer be exported once it cannot be detected.
+func TestUpdateClearsCurrentIPOnDetectionFailure(t *testing.T) {
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1", "unavailable"}, onLast: func() {}}
+	u := newTestUpdater(ih, &target{record: config.Record{Domain: "one.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{}})
+	u.metrics = metrics.New()
+
+	u.update(context.Background())
+	u.update(context.Background())
+
+	var b strings.Builder
+	u.metrics.WriteTo(&b)
+	if strings.Contains(b.String(), "ddclient_current_ip_info{") {
+		t.Errorf("Expected no current address; got:\n%s", b.String())
+	}
+	if !strings.Contains(b.String(), `ddclient_failures_total{stage="detection"} 1`) {
+		t.Errorf("Expected detection failure; got:\n%s", b.String())
+	}
+}
@@ -14,6 +14,25 @@ func GetAppConfig() *config.App {
 			APIKey:			"api-key",
 			SecretKey:	"secret-key",
 		},
+		Schedule: config.Schedule{
+			Interval: config.DefaultInterval,
+		},
+		State: config.State{
+			VerifyInterval: config.DefaultVerifyInterval,
+		},
+		Detection: config.Detection{
+			IPv4Sources: []string{config.DefaultIPSource},
+			IPv6Sources: []string{config.DefaultIPSource},
+			Quorum:      1,
+		},
+		HTTP: config.HTTP{
+			Timeout:     config.DefaultHTTPTimeout,
+			MaxAttempts: config.DefaultHTTPMaxAttempts,
+		},
+		Logging: config.Logging{
+			Level:  config.DefaultLogLevel,
+			Format: config.DefaultLogFormat,
+		},
 	}
 }
 
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// CommandNotifier runs a shell command for each event.
+type CommandNotifier struct {
+	command string
+}
+
+// NewCommandNotifier runs command with sh -c for each event. Details of the event are passed in
+// the environment variables DDCLIENT_EVENT, DDCLIENT_RECORD, DDCLIENT_TYPE, DDCLIENT_PROVIDER,
+// DDCLIENT_OLD_IP, DDCLIENT_NEW_IP, DDCLIENT_ERROR and DDCLIENT_FAILURES.
+func NewCommandNotifier(command string) *CommandNotifier {
+	return &CommandNotifier{command: command}
+}
+
+func (n *CommandNotifier) Notify(ctx context.Context, e Event) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", n.command)
+	cmd.Env = append(os.Environ(),
+		"DDCLIENT_EVENT="+e.Kind,
+		"DDCLIENT_RECORD="+e.Record,
+		"DDCLIENT_TYPE="+e.Type,
+		"DDCLIENT_PROVIDER="+e.Provider,
+		"DDCLIENT_OLD_IP="+e.OldIP,
+		"DDCLIENT_NEW_IP="+e.NewIP,
+		"DDCLIENT_ERROR="+e.Error,
+		"DDCLIENT_FAILURES="+strconv.Itoa(e.Failures),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("command failed: %w; %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
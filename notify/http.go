@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bhorvath/ddclient/config"
+)
+
+// WebhookNotifier posts each event as JSON to a URL.
+type WebhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// NewWebhookNotifier posts events to url using client.
+func NewWebhookNotifier(client *http.Client, url string) *WebhookNotifier {
+	return &WebhookNotifier{client: client, url: url}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.client, n.url, body, map[string]string{"Content-Type": "application/json"})
+}
+
+// NtfyNotifier publishes each event to an ntfy topic.
+type NtfyNotifier struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+// NewNtfyNotifier publishes events to the topic at url, e.g. "https://ntfy.sh/my-topic", using
+// client. If token is set then it is sent as the access token.
+func NewNtfyNotifier(client *http.Client, url, token string) *NtfyNotifier {
+	return &NtfyNotifier{client: client, url: url, token: token}
+}
+
+func (n *NtfyNotifier) Notify(ctx context.Context, e Event) error {
+	h := map[string]string{"Title": e.Title(), "Tags": e.Kind}
+	if e.Kind == config.EventFailed {
+		h["Priority"] = "high"
+	}
+	if n.token != "" {
+		h["Authorization"] = "Bearer " + n.token
+	}
+	return post(ctx, n.client, n.url, []byte(e.Message()), h)
+}
+
+// GotifyNotifier pushes each event to a Gotify server.
+type GotifyNotifier struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// NewGotifyNotifier pushes events to the Gotify server at url, e.g. "https://gotify.example.com",
+// as the application with the given token, using client.
+func NewGotifyNotifier(client *http.Client, url, token string) *GotifyNotifier {
+	return &GotifyNotifier{client: client, url: strings.TrimSuffix(url, "/"), token: token}
+}
+
+func (n *GotifyNotifier) Notify(ctx context.Context, e Event) error {
+	m := gotifyMessage{Title: e.Title(), Message: e.Message(), Priority: 5}
+	if e.Kind == config.EventFailed {
+		m.Priority = 8
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.client, n.url+"/message", body, map[string]string{
+		"Content-Type": "application/json",
+		"X-Gotify-Key": n.token,
+	})
+}
+
+// post sends body to url with the given headers.
+func post(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	statusOK := res.StatusCode >= 200 && res.StatusCode < 300
+	if !statusOK {
+		resBody, _ := io.ReadAll(res.Body)
+		return errors.New("failed to send notification; " + res.Status + " " + string(resBody))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Package notify tells people about changes to DNS records and failures to update them, using
+// webhooks, push notification services, email or local commands.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/retry"
+)
+
+// Event is something which happened to a DNS record.
+type Event struct {
+	// Kind is one of config.EventChanged, config.EventCreated or config.EventFailed.
+	Kind     string `json:"event"`
+	Record   string `json:"record"`
+	Type     string `json:"type"`
+	Provider string `json:"provider"`
+	// OldIP is the address held by the record before it was changed. It is empty if the record
+	// was created, or if the address is not known.
+	OldIP string `json:"old_ip,omitempty"`
+	// NewIP is the current address, which the record holds unless the update failed.
+	NewIP string `json:"new_ip,omitempty"`
+	// Error describes why the update failed.
+	Error string `json:"error,omitempty"`
+	// Failures is the number of consecutive failed updates of the record.
+	Failures int       `json:"failures,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Title summarises the event in a few words, e.g. for the subject of an email.
+func (e Event) Title() string {
+	return fmt.Sprintf("ddclient: %s (%s) %s", e.Record, e.Type, e.Kind)
+}
+
+// Message describes the event in a sentence.
+func (e Event) Message() string {
+	switch e.Kind {
+	case config.EventChanged:
+		return fmt.Sprintf("%s (%s) changed from %s to %s", e.Record, e.Type, e.OldIP, e.NewIP)
+	case config.EventCreated:
+		return fmt.Sprintf("%s (%s) created with %s", e.Record, e.Type, e.NewIP)
+	}
+	return fmt.Sprintf("%s (%s) failed to update %v time(s): %s", e.Record, e.Type, e.Failures, e.Error)
+}
+
+// Notifier sends an event somewhere. The context bounds any request made while doing so.
+type Notifier interface {
+	Notify(context.Context, Event) error
+}
+
+// Dispatcher sends each event to the notifiers configured to receive it. A nil *Dispatcher discards
+// every event.
+type Dispatcher struct {
+	notifiers []filtered
+}
+
+// filtered is a notifier along with the events it receives.
+type filtered struct {
+	Notifier
+	kind      string
+	events    []string
+	failAfter int
+}
+
+// wants reports whether the notifier receives e. Failed events are only received when the number
+// of consecutive failures reaches failAfter, so that a record which keeps failing is only notified
+// once.
+func (f filtered) wants(e Event) bool {
+	if len(f.events) > 0 && !slices.Contains(f.events, e.Kind) {
+		return false
+	}
+	if e.Kind == config.EventFailed {
+		return e.Failures == max(f.failAfter, 1)
+	}
+	return true
+}
+
+// New returns a dispatcher sending events to the given notifications. Notifications made over HTTP
+// use client. If client is nil then retry.DefaultClient is used.
+func New(notifications []config.Notification, client *http.Client) (*Dispatcher, error) {
+	if client == nil {
+		client = retry.DefaultClient
+	}
+	d := &Dispatcher{}
+	for _, n := range notifications {
+		var nr Notifier
+		switch n.Type {
+		case config.NotifyWebhook:
+			nr = NewWebhookNotifier(client, n.URL)
+		case config.NotifyNtfy:
+			nr = NewNtfyNotifier(client, n.URL, n.Token)
+		case config.NotifyGotify:
+			nr = NewGotifyNotifier(client, n.URL, n.Token)
+		case config.NotifySMTP:
+			nr = NewSMTPNotifier(n.SMTPServer, n.SMTPUsername, n.SMTPPassword, n.From, n.To)
+		case config.NotifyCommand:
+			nr = NewCommandNotifier(n.Command)
+		default:
+			return nil, fmt.Errorf("notification type %q not supported", n.Type)
+		}
+		d.notifiers = append(d.notifiers, filtered{Notifier: nr, kind: n.Type, events: n.Events, failAfter: n.FailAfter})
+	}
+	return d, nil
+}
+
+// Notify sends e to every notifier configured to receive it. Every notifier is attempted, and any
+// failures are returned together.
+func (d *Dispatcher) Notify(ctx context.Context, e Event) error {
+	if d == nil {
+		return nil
+	}
+	var errs []error
+	for _, n := range d.notifiers {
+		if !n.wants(e) {
+			continue
+		}
+		if err := n.Notify(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s notification: %w", n.kind, err))
+		}
+	}
+	return errors.Join(errs...)
+}
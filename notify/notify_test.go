@@ -0,0 +1,318 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+)
+
+var changed = Event{
+	Kind:     config.EventChanged,
+	Record:   "www.example.com",
+	Type:     "A",
+	Provider: "porkbun",
+	OldIP:    "10.0.0.1",
+	NewIP:    "10.0.0.2",
+	Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+// Expect events to only be sent to notifiers configured to receive them, and failed events to only
+// be sent once the record has failed the configured number of times.
+func TestDispatcherFiltersEvents(t *testing.T) {
+	all := &fakeNotifier{}
+	failures := &fakeNotifier{}
+	d := &Dispatcher{notifiers: []filtered{
+		{Notifier: all, failAfter: 1},
+		{Notifier: failures, events: []string{config.EventFailed}, failAfter: 2},
+	}}
+
+	d.Notify(context.Background(), changed)
+	for i := 1; i <= 3; i++ {
+		d.Notify(context.Background(), Event{Kind: config.EventFailed, Failures: i})
+	}
+
+	if want := []string{"changed", "failed 1"}; !slices.Equal(all.events, want) {
+		t.Errorf("Got events: %v; want: %v", all.events, want)
+	}
+	if want := []string{"failed 2"}; !slices.Equal(failures.events, want) {
+		t.Errorf("Got events: %v; want: %v", failures.events, want)
+	}
+}
+
+// Expect every notifier to be attempted even if one fails, and for the failure to be returned.
+func TestDispatcherContinuesAfterFailure(t *testing.T) {
+	working := &fakeNotifier{}
+	d := &Dispatcher{notifiers: []filtered{
+		{Notifier: &fakeNotifier{err: errors.New("unavailable")}, kind: "webhook"},
+		{Notifier: working},
+	}}
+
+	err := d.Notify(context.Background(), changed)
+
+	if err == nil || !strings.Contains(err.Error(), "webhook notification: unavailable") {
+		t.Errorf("Expected notification error; got: %v", err)
+	}
+	if len(working.events) != 1 {
+		t.Errorf("Got events: %v; want: 1", len(working.events))
+	}
+}
+
+// Expect a nil dispatcher to discard events.
+func TestNilDispatcher(t *testing.T) {
+	var d *Dispatcher
+	if err := d.Notify(context.Background(), changed); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Expect an error for unknown notification types.
+func TestNewErrorIfTypeUnknown(t *testing.T) {
+	if _, err := New([]config.Notification{{Type: "pager"}}, nil); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Expect webhooks to receive the event as JSON.
+func TestWebhookPostsJSON(t *testing.T) {
+	var got Event
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Got content type: %v; want: application/json", ct)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer svr.Close()
+
+	if err := NewWebhookNotifier(svr.Client(), svr.URL).Notify(context.Background(), changed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != changed {
+		t.Errorf("Got: %v; want: %v", got, changed)
+	}
+}
+
+// Expect an error if the webhook responds with an error status.
+func TestWebhookErrorStatus(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer svr.Close()
+
+	if err := NewWebhookNotifier(svr.Client(), svr.URL).Notify(context.Background(), changed); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
+
+// Expect ntfy topics to receive the message with a title and access token.
+func TestNtfyPublishesMessage(t *testing.T) {
+	var title, auth, body string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title = r.Header.Get("Title")
+		auth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer svr.Close()
+
+	if err := NewNtfyNotifier(svr.Client(), svr.URL+"/ddclient", "tk_secret").Notify(context.Background(), changed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "ddclient: www.example.com (A) changed"; title != want {
+		t.Errorf("Got title: %v; want: %v", title, want)
+	}
+	if auth != "Bearer tk_secret" {
+		t.Errorf("Got authorization: %v; want: Bearer tk_secret", auth)
+	}
+	if want := "www.example.com (A) changed from 10.0.0.1 to 10.0.0.2"; body != want {
+		t.Errorf("Got message: %v; want: %v", body, want)
+	}
+}
+
+// Expect Gotify servers to receive the message using the application token.
+func TestGotifyPushesMessage(t *testing.T) {
+	var path, key string
+	var got gotifyMessage
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		key = r.Header.Get("X-Gotify-Key")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer svr.Close()
+
+	if err := NewGotifyNotifier(svr.Client(), svr.URL+"/", "app-token").Notify(context.Background(), changed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path != "/message" {
+		t.Errorf("Got path: %v; want: /message", path)
+	}
+	if key != "app-token" {
+		t.Errorf("Got token: %v; want: app-token", key)
+	}
+	if got.Message != changed.Message() || got.Title != changed.Title() {
+		t.Errorf("Got: %v; want: %v", got, changed.Message())
+	}
+}
+
+// Expect emails to be sent to every recipient with the event as the subject.
+func TestSMTPSendsEmail(t *testing.T) {
+	m := newMockSMTPServer(t)
+	n := NewSMTPNotifier(m.addr, "user", "pass", "ddclient@example.com", []string{"a@example.com", "b@example.com"})
+
+	if err := n.Notify(context.Background(), changed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	session := <-m.sessions
+	for _, want := range []string{
+		"AUTH PLAIN",
+		"MAIL FROM:<ddclient@example.com>",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"Subject: ddclient: www.example.com (A) changed\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"\r\n\r\n" + changed.Message(),
+		"QUIT",
+	} {
+		if !strings.Contains(session, want) {
+			t.Errorf("Expected session to contain %q; got: %v", want, session)
+		}
+	}
+}
+
+// Expect a mail server which never responds to be given up on once the context is done.
+func TestSMTPTimesOut(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	n := NewSMTPNotifier(l.Addr().String(), "", "", "ddclient@example.com", []string{"a@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- n.Notify(ctx, changed) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded; got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Notify to return once the context is done")
+	}
+}
+
+// Expect commands to be run with the details of the event in the environment.
+func TestCommandReceivesEnvironment(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	n := NewCommandNotifier(`echo "$DDCLIENT_EVENT $DDCLIENT_RECORD $DDCLIENT_OLD_IP $DDCLIENT_NEW_IP" > ` + out)
+
+	if err := n.Notify(context.Background(), changed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	if want := "changed www.example.com 10.0.0.1 10.0.0.2\n"; string(got) != want {
+		t.Errorf("Got: %q; want: %q", got, want)
+	}
+}
+
+// Expect an error including the output of commands which fail.
+func TestCommandErrorIfFails(t *testing.T) {
+	err := NewCommandNotifier("echo broken >&2; exit 3").Notify(context.Background(), changed)
+
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected command error; got: %v", err)
+	}
+}
+
+type fakeNotifier struct {
+	events []string
+	err    error
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, e Event) error {
+	s := e.Kind
+	if e.Kind == config.EventFailed {
+		s += " " + strconv.Itoa(e.Failures)
+	}
+	n.events = append(n.events, s)
+	return n.err
+}
+
+// mockSMTPServer accepts a single SMTP session without TLS, recording everything the client sends.
+type mockSMTPServer struct {
+	addr     string
+	sessions chan string
+}
+
+func newMockSMTPServer(t *testing.T) *mockSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	m := &mockSMTPServer{addr: l.Addr().String(), sessions: make(chan string, 1)}
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var session strings.Builder
+		r := bufio.NewReader(c)
+		fmt.Fprint(c, "220 mock ESMTP\r\n")
+		data := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			session.WriteString(line)
+			switch {
+			case data:
+				if line == ".\r\n" {
+					data = false
+					fmt.Fprint(c, "250 queued\r\n")
+				}
+			case strings.HasPrefix(line, "EHLO"):
+				fmt.Fprint(c, "250-mock\r\n250 AUTH PLAIN\r\n")
+			case strings.HasPrefix(line, "AUTH"):
+				fmt.Fprint(c, "235 authenticated\r\n")
+			case strings.HasPrefix(line, "DATA"):
+				data = true
+				fmt.Fprint(c, "354 go ahead\r\n")
+			case strings.HasPrefix(line, "QUIT"):
+				fmt.Fprint(c, "221 bye\r\n")
+				m.sessions <- session.String()
+				return
+			default:
+				fmt.Fprint(c, "250 ok\r\n")
+			}
+		}
+		m.sessions <- session.String()
+	}()
+	return m
+}
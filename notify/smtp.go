@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier emails each event.
+type SMTPNotifier struct {
+	server   string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPNotifier emails events from from to each address in to using the mail server at server,
+// e.g. "smtp.example.com:587". If username is set then the server is authenticated with, which
+// requires it to support TLS.
+func NewSMTPNotifier(server, username, password, from string, to []string) *SMTPNotifier {
+	return &SMTPNotifier{
+		server:   server,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}
+}
+
+// Notify emails e, using STARTTLS if the mail server supports it. The connection is closed once
+// ctx is done, so that a stalled mail server cannot block the caller.
+func (n *SMTPNotifier) Notify(ctx context.Context, e Event) error {
+	err := n.send(ctx, n.message(e))
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		// The connection deadline, taken from ctx, can pass just before ctx is done
+		return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// send delivers msg to every recipient over a single SMTP session, as smtp.SendMail does.
+func (n *SMTPNotifier) send(ctx context.Context, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(n.server)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("mail server does not support authentication")
+		}
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message returns the email sent for e.
+func (n *SMTPNotifier) message(e Event) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", e.Title())
+	fmt.Fprintf(&b, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(e.Message() + "\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,152 @@
+// Package retry provides an HTTP transport which retries requests failing with transient errors.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policy specifies how failed requests are retried.
+type Policy struct {
+	// MaxAttempts is the total number of attempts made for a request, including the first.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with each further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. A server asking to wait longer than this using
+	// Retry-After is not retried.
+	MaxDelay time.Duration
+}
+
+// DefaultPolicy makes up to 4 attempts over roughly 4 seconds, or longer if rate limited.
+var DefaultPolicy = Policy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// DefaultClient is an HTTP client retrying requests according to DefaultPolicy.
+var DefaultClient = NewClient(DefaultPolicy)
+
+// Transport is an http.RoundTripper which retries requests failing with a network error, a 5xx
+// status or 429 Too Many Requests. Retries are delayed using exponential backoff with full jitter,
+// unless the server specifies a delay with Retry-After. Requests made with a context returned by
+// NonIdempotent are only retried if they cannot have been processed.
+type Transport struct {
+	// Base makes the individual attempts. If nil, http.DefaultTransport is used.
+	Base   http.RoundTripper
+	Policy Policy
+}
+
+type nonIdempotentKey struct{}
+
+// NonIdempotent returns a copy of ctx marking requests made with it as unsafe to repeat, such as
+// those creating records. They are only retried when rate limited or if the connection could not be
+// established, as otherwise the server may have acted on a request whose response was lost.
+func NonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentKey{}, true)
+}
+
+// NewTransport returns a Transport making attempts using base.
+func NewTransport(base http.RoundTripper, p Policy) *Transport {
+	return &Transport{Base: base, Policy: p}
+}
+
+// NewClient returns an HTTP client retrying requests according to p.
+func NewClient(p Policy) *http.Client {
+	return &http.Client{Transport: NewTransport(nil, p)}
+}
+
+// RoundTrip sends req, retrying it as required. Requests with a body are only retried if the body
+// can be obtained again using req.GetBody, as is the case for requests created by
+// http.NewRequest with a bytes or strings reader.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := base.RoundTrip(req)
+		if attempt >= t.Policy.MaxAttempts || !retryable(req, res, err) || req.Context().Err() != nil {
+			return res, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+
+		delay := t.backoff(attempt)
+		if res != nil {
+			if d, ok := retryAfter(res); ok {
+				if d > t.Policy.MaxDelay {
+					return res, err
+				}
+				delay = d
+			}
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// backoff returns a random delay of up to BaseDelay doubled for each previous retry, capped at
+// MaxDelay.
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.Policy.BaseDelay << (attempt - 1)
+	if d <= 0 || d > t.Policy.MaxDelay {
+		d = t.Policy.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d) + 1
+}
+
+// retryable reports whether an attempt of req with the given outcome should be retried.
+func retryable(req *http.Request, res *http.Response, err error) bool {
+	idempotent := req.Context().Value(nonIdempotentKey{}) == nil
+	if err != nil {
+		var op *net.OpError
+		return idempotent || errors.As(err, &op) && op.Op == "dial"
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return idempotent && res.StatusCode >= 500 && res.StatusCode != http.StatusNotImplemented
+}
+
+// retryAfter returns the delay requested by the Retry-After header of res, given either in seconds
+// or as an HTTP date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,210 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+// Expect requests failing with a 5xx status to be retried until they succeed.
+func TestRetriesServerErrors(t *testing.T) {
+	m := NewFlakyServer(2, http.StatusServiceUnavailable)
+	m.setupRoutes()
+	defer m.svr.Close()
+
+	res, err := NewClient(testPolicy).Get(m.svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Got status: %v; want: %v", res.StatusCode, http.StatusOK)
+	}
+	if m.calls != 3 {
+		t.Errorf("Got calls: %v; want: 3", m.calls)
+	}
+}
+
+// Expect the last response to be returned once the attempt budget is spent.
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	m := NewFlakyServer(10, http.StatusBadGateway)
+	m.setupRoutes()
+	defer m.svr.Close()
+
+	res, err := NewClient(testPolicy).Get(m.svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Got status: %v; want: %v", res.StatusCode, http.StatusBadGateway)
+	}
+	if m.calls != testPolicy.MaxAttempts {
+		t.Errorf("Got calls: %v; want: %v", m.calls, testPolicy.MaxAttempts)
+	}
+}
+
+// Expect client errors other than rate limiting not to be retried.
+func TestDoesNotRetryClientErrors(t *testing.T) {
+	m := NewFlakyServer(1, http.StatusBadRequest)
+	m.setupRoutes()
+	defer m.svr.Close()
+
+	res, err := NewClient(testPolicy).Get(m.svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if m.calls != 1 {
+		t.Errorf("Got calls: %v; want: 1", m.calls)
+	}
+}
+
+// Expect rate limited requests to wait for the delay given by Retry-After.
+func TestHonoursRetryAfter(t *testing.T) {
+	m := NewFlakyServer(1, http.StatusTooManyRequests)
+	m.retryAfter = "1"
+	m.setupRoutes()
+	defer m.svr.Close()
+	p := testPolicy
+	p.MaxDelay = 5 * time.Second
+
+	start := time.Now()
+	res, err := NewClient(p).Get(m.svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Got delay: %v; want: at least 1s", elapsed)
+	}
+	if m.calls != 2 {
+		t.Errorf("Got calls: %v; want: 2", m.calls)
+	}
+}
+
+// Expect the rate limited response to be returned if Retry-After exceeds the maximum delay.
+func TestGivesUpIfRetryAfterTooLong(t *testing.T) {
+	m := NewFlakyServer(1, http.StatusTooManyRequests)
+	m.retryAfter = "3600"
+	m.setupRoutes()
+	defer m.svr.Close()
+
+	res, err := NewClient(testPolicy).Get(m.svr.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests || m.calls != 1 {
+		t.Errorf("Got status: %v after %v call(s); want: 429 after 1", res.StatusCode, m.calls)
+	}
+}
+
+// Expect the request body to be sent again with each attempt.
+func TestResendsBody(t *testing.T) {
+	m := NewFlakyServer(1, http.StatusInternalServerError)
+	m.setupRoutes()
+	defer m.svr.Close()
+
+	res, err := NewClient(testPolicy).Post(m.svr.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if len(m.bodies) != 2 || m.bodies[0] != "payload" || m.bodies[1] != "payload" {
+		t.Errorf("Got bodies: %q; want: [payload payload]", m.bodies)
+	}
+}
+
+// Expect network errors to be retried.
+func TestRetriesNetworkErrors(t *testing.T) {
+	calls := 0
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, errors.New("connection reset")
+	})
+	c := &http.Client{Transport: NewTransport(base, testPolicy)}
+
+	if _, err := c.Get("http://example.com"); err == nil {
+		t.Error("Expected error; got nil")
+	}
+	if calls != testPolicy.MaxAttempts {
+		t.Errorf("Got calls: %v; want: %v", calls, testPolicy.MaxAttempts)
+	}
+}
+
+// Expect requests marked as non-idempotent to only be retried if they cannot have been processed.
+func TestNonIdempotentRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		res   *http.Response
+		err   error
+		calls int
+	}{
+		{"server error", &http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody}, nil, 1},
+		{"connection reset", nil, errors.New("connection reset"), 1},
+		{"rate limited", &http.Response{StatusCode: http.StatusTooManyRequests, Body: http.NoBody}, nil, testPolicy.MaxAttempts},
+		{"dial error", nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}, testPolicy.MaxAttempts},
+	}
+	for _, tt := range tests {
+		calls := 0
+		base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return tt.res, tt.err
+		})
+		c := &http.Client{Transport: NewTransport(base, testPolicy)}
+		req, _ := http.NewRequestWithContext(NonIdempotent(context.Background()), http.MethodPost, "http://example.com", strings.NewReader("payload"))
+
+		if res, err := c.Do(req); err == nil {
+			res.Body.Close()
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: Got calls: %v; want: %v", tt.name, calls, tt.calls)
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// FlakyServer fails the first few requests it receives with the given status.
+type FlakyServer struct {
+	svr        *httptest.Server
+	failures   int
+	status     int
+	retryAfter string
+	calls      int
+	bodies     []string
+}
+
+func NewFlakyServer(failures int, status int) *FlakyServer {
+	return &FlakyServer{failures: failures, status: status}
+}
+
+func (m *FlakyServer) setupRoutes() {
+	m.svr = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.calls++
+		b, _ := io.ReadAll(r.Body)
+		m.bodies = append(m.bodies, string(b))
+		if m.calls <= m.failures {
+			if m.retryAfter != "" {
+				w.Header().Set("Retry-After", m.retryAfter)
+			}
+			w.WriteHeader(m.status)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+}
@@ -0,0 +1,82 @@
+package state
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry records the IP address most recently published to a DNS record.
+type Entry struct {
+	IP netip.Addr
+	// Verified is when the provider last confirmed that the record held IP.
+	Verified time.Time
+	// Settings fingerprints the record settings, such as the TTL and notes, applied along with IP,
+	// so that a change to them is applied even though the address is unchanged.
+	Settings string `json:",omitempty"`
+	// Failures is the number of consecutive failed updates of the record, so that failures can be
+	// counted across runs.
+	Failures int `json:",omitempty"`
+}
+
+// Store persists an Entry for each DNS record in a file, so that the provider need not be contacted
+// while the IP address is unchanged.
+type Store struct {
+	path    string
+	entries map[string]Entry
+}
+
+// Load reads the state file at path. A missing file results in an empty store.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]Entry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the entry for the record identified by key.
+func (s *Store) Get(key string) (Entry, bool) {
+	e, ok := s.entries[key]
+	return e, ok
+}
+
+// Set replaces the entry for the record identified by key. The store must be saved for the change to
+// persist.
+func (s *Store) Set(key string, e Entry) {
+	s.entries[key] = e
+}
+
+// Save writes the store to its file. The file is replaced atomically so that an interrupted save
+// cannot leave it corrupt.
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,53 @@
+package state
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Expect saved entries to be returned once the store is loaded again.
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := Entry{IP: netip.MustParseAddr("10.0.0.1"), Verified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	s.Set("porkbun:www.example.com/A", want)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, ok := loaded.Get("porkbun:www.example.com/A")
+	if !ok || got.IP != want.IP || !got.Verified.Equal(want.Verified) {
+		t.Errorf("Got: %v; want: %v", got, want)
+	}
+}
+
+// Expect a missing state file to result in an empty store rather than an error.
+func TestLoadMissingFile(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := s.Get("anything"); ok {
+		t.Error("Expected no entry")
+	}
+}
+
+// Expect an error if the state file is corrupt.
+func TestLoadCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(path, []byte("{not json"), 0600)
+
+	if _, err := Load(path); err == nil {
+		t.Error("Expected error; got nil")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/dns"
+	"github.com/bhorvath/ddclient/ipaddress"
+	"github.com/bhorvath/ddclient/metrics"
+	"github.com/bhorvath/ddclient/notify"
+	"github.com/bhorvath/ddclient/state"
+)
+
+// updater keeps a set of DNS records up to date with the current IP addresses.
+type updater struct {
+	ipHandlers map[ipaddress.Family]ipaddress.IPAddressHandler
+	targets    []*target
+	// state persists the address published to each target between runs. It is nil if no state
+	// file has been configured.
+	state *state.Store
+	// verifyInterval is how long a record is trusted to still hold the address last published to
+	// it before the provider is checked again.
+	verifyInterval time.Duration
+	// runTimeout bounds each run of update. Zero means no limit.
+	runTimeout time.Duration
+	// dryRun is set when the handlers only report changes. Every record is then checked with its
+	// provider and nothing is written to the state store.
+	dryRun bool
+	// logger receives the outcome of each check.
+	logger *slog.Logger
+	// metrics records the outcome of each check. It is nil if metrics are not served.
+	metrics *metrics.Metrics
+	// notifier is told of changed records and failed updates. It is nil if no notifications have
+	// been configured.
+	notifier *notify.Dispatcher
+}
+
+// notifyTimeout bounds the sending of each notification.
+const notifyTimeout = 30 * time.Second
+
+// target is a DNS record which is kept up to date with the current IP address.
+type target struct {
+	record   config.Record
+	provider string
+	handler  dns.DNSHandler
+	// family is the IP address family held by the record.
+	family ipaddress.Family
+	// last is the IP address most recently published to the record.
+	last netip.Addr
+	// verified is when the provider last confirmed that the record held last.
+	verified time.Time
+	// applied is the fingerprint, as returned by settings, of the record settings in force when
+	// last was published.
+	applied string
+	// failures is the number of consecutive failed updates of the record.
+	failures int
+}
+
+// key identifies the target in the state store.
+func (t *target) key() string {
+	return t.provider + ":" + t.record.FQDN() + "/" + t.record.Type
+}
+
+// settings fingerprints the configured settings of the record other than its address, so that a
+// change to them is applied without waiting for the verify interval to pass. It is empty if none
+// are set, matching state files written before settings were recorded.
+func (t *target) settings() string {
+	r := t.record
+	var s []string
+	if r.TTL != 0 {
+		s = append(s, fmt.Sprintf("ttl=%d", r.TTL))
+	}
+	if r.Notes != "" {
+		s = append(s, fmt.Sprintf("notes=%q", r.Notes))
+	}
+	if r.MultipleRecords != "" {
+		s = append(s, "multiple-records="+r.MultipleRecords)
+	}
+	if r.RecordID != "" {
+		s = append(s, "record-id="+r.RecordID)
+	}
+	return strings.Join(s, " ")
+}
+
+// restoreState initialises the last published address and failure count of each target from the
+// state store.
+func (u *updater) restoreState() {
+	if u.state == nil {
+		return
+	}
+	for _, t := range u.targets {
+		if e, ok := u.state.Get(t.key()); ok {
+			t.last = e.IP
+			t.verified = e.Verified
+			t.applied = e.Settings
+			t.failures = e.Failures
+		}
+	}
+}
+
+// remember records the last published address and failure count of t in the state store, if there
+// is one. It reports whether the store was changed and so needs saving.
+func (u *updater) remember(t *target) bool {
+	if u.state == nil || u.dryRun {
+		return false
+	}
+	u.state.Set(t.key(), state.Entry{IP: t.last, Verified: t.verified, Settings: t.applied, Failures: t.failures})
+	return true
+}
+
+// update retrieves the current IP address of each family used by the targets and updates every
+// target whose record is not already known to contain it. It returns the number of records which
+// were changed, or in dry run mode would have been. Failures are reported per record and returned
+// together once every target has been attempted. Requests in flight are aborted once ctx is done or
+// the run timeout has passed.
+func (u *updater) update(ctx context.Context) (int, error) {
+	if u.runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.runTimeout)
+		defer cancel()
+	}
+
+	ips := make(map[ipaddress.Family]netip.Addr)
+	ipErrs := make(map[ipaddress.Family]error)
+	for _, t := range u.targets {
+		if _, ok := ips[t.family]; ok || ipErrs[t.family] != nil {
+			continue
+		}
+		ip, err := currentIP(ctx, u.ipHandlers[t.family], t.family)
+		if err != nil {
+			u.logger.Error("Error getting current address", "family", t.family, "error", err)
+			u.metrics.RecordFailure(metrics.StageDetection)
+			u.metrics.ClearCurrentIP(t.family.String())
+			ipErrs[t.family] = err
+			continue
+		}
+		u.logger.Info("Current address", "family", t.family, "ip", ip)
+		u.metrics.SetCurrentIP(t.family.String(), ip)
+		ips[t.family] = ip
+	}
+
+	var errs []error
+	changes := 0
+	dirty := false
+	for _, t := range u.targets {
+		name := fmt.Sprintf("%s (%s)", t.record.FQDN(), t.record.Type)
+		if err := ipErrs[t.family]; err != nil {
+			err = fmt.Errorf("no current %v address: %w", t.family, err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			u.failed(ctx, t, err)
+			dirty = u.remember(t) || dirty
+			continue
+		}
+		ip := ips[t.family]
+		log := u.logger.With("record", t.record.FQDN(), "type", t.record.Type)
+		if !u.dryRun && t.last == ip && t.applied == t.settings() && time.Since(t.verified) < u.verifyInterval {
+			// The record is known to hold the address and settings, so this counts as a successful
+			// check.
+			log.Debug("IP address has not changed since last check", "ip", ip)
+			u.metrics.RecordUpdate(t.record.FQDN(), t.record.Type, dns.NoChange, time.Now())
+			if t.failures > 0 {
+				t.failures = 0
+				dirty = u.remember(t) || dirty
+			}
+			continue
+		}
+
+		start := time.Now()
+		res, err := t.handler.Update(ctx, ip)
+		u.metrics.ObserveUpdateDuration(t.provider, time.Since(start))
+		if err != nil {
+			log.Error("Error updating DNS entry", "error", err)
+			u.metrics.RecordFailure(metrics.StageProvider)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			u.failed(ctx, t, err)
+			dirty = u.remember(t) || dirty
+			continue
+		}
+		logResult(log, res, u.dryRun)
+		u.metrics.RecordUpdate(t.record.FQDN(), t.record.Type, res.Action, time.Now())
+		t.failures = 0
+		if res.Action != dns.NoChange {
+			changes++
+		}
+		if u.dryRun {
+			continue
+		}
+		switch old := previousIP(res, t.last); {
+		case res.Action == dns.Created:
+			u.notify(ctx, t.event(config.EventCreated, "", ip))
+		case res.Action == dns.Updated && old != ip.String():
+			u.notify(ctx, t.event(config.EventChanged, old, ip))
+		}
+		t.last = ip
+		t.verified = time.Now()
+		t.applied = t.settings()
+		dirty = u.remember(t) || dirty
+	}
+
+	if dirty {
+		if err := u.state.Save(); err != nil {
+			u.logger.Error("Error saving state", "error", err)
+		}
+	}
+
+	if errs != nil {
+		return changes, fmt.Errorf("Failed to update %v of %v record(s): %w", len(errs), len(u.targets), errors.Join(errs...))
+	}
+	return changes, nil
+}
+
+// failed counts a failed update of t and notifies of it.
+func (u *updater) failed(ctx context.Context, t *target, err error) {
+	t.failures++
+	if u.dryRun {
+		return
+	}
+	e := t.event(config.EventFailed, "", netip.Addr{})
+	e.Error = err.Error()
+	u.notify(ctx, e)
+}
+
+// notify sends e to the notifier, logging any failure. Notifications are still sent once ctx is
+// done, e.g. when the run has timed out, as failures are then most worth knowing about.
+func (u *updater) notify(ctx context.Context, e notify.Event) {
+	if u.notifier == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+	if err := u.notifier.Notify(ctx, e); err != nil {
+		u.logger.Error("Error sending notification", "record", e.Record, "type", e.Type, "event", e.Kind, "error", err)
+	}
+}
+
+// event returns an event of the given kind for t, with the old and new IP addresses of the record.
+func (t *target) event(kind, old string, ip netip.Addr) notify.Event {
+	e := notify.Event{
+		Kind:     kind,
+		Record:   t.record.FQDN(),
+		Type:     t.record.Type,
+		Provider: t.provider,
+		OldIP:    old,
+		Failures: t.failures,
+		Time:     time.Now(),
+	}
+	if ip.IsValid() {
+		e.NewIP = ip.String()
+	}
+	return e
+}
+
+// previousIP returns the address held by a record before res was applied. It is read from the
+// content reported by the handler, falling back to the address last published to the record.
+func previousIP(res dns.Result, last netip.Addr) string {
+	f := strings.FieldsFunc(res.Old, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(f) > 0 {
+		if ip, err := netip.ParseAddr(f[0]); err == nil {
+			return ip.String()
+		}
+	}
+	if last.IsValid() {
+		return last.String()
+	}
+	return ""
+}
+
+// logResult logs the outcome of updating a record, with the action taken and the old and new
+// content of the record.
+func logResult(log *slog.Logger, res dns.Result, dryRun bool) {
+	msg := "Record changed"
+	switch {
+	case res.Action == dns.NoChange:
+		msg = "Record already up to date"
+	case dryRun:
+		msg = "Dry run, record not changed"
+	}
+	attrs := []any{"action", res.Action.String(), "old", res.Old, "new", res.New}
+	if res.Deleted > 0 {
+		attrs = append(attrs, "deleted", res.Deleted)
+	}
+	log.Info(msg, attrs...)
+}
+
+// currentIP retrieves the current IP address using ih, checking that it belongs to the expected
+// family.
+func currentIP(ctx context.Context, ih ipaddress.IPAddressHandler, f ipaddress.Family) (netip.Addr, error) {
+	if ih == nil {
+		return netip.Addr{}, fmt.Errorf("no %v address source configured", f)
+	}
+	ip, err := ih.GetCurrent(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if !f.Contains(ip) {
+		return netip.Addr{}, fmt.Errorf("expected an %v address; got: %v", f, ip)
+	}
+	return ip, nil
+}
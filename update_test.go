@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/ipaddress"
+	"github.com/bhorvath/ddclient/notify"
+	"github.com/bhorvath/ddclient/state"
+)
+
+// Expect every record to be attempted even if updating one of them fails, and for the failure to be
+// reported.
+func TestUpdateContinuesAfterRecordFailure(t *testing.T) {
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	failing := &fakeDNSHandler{failures: 1}
+	working := &fakeDNSHandler{}
+	targets := []*target{
+		{record: config.Record{Domain: "one.com", Type: "A"}, handler: failing},
+		{record: config.Record{Domain: "two.com", Type: "A"}, handler: working},
+	}
+
+	_, err := newTestUpdater(ih, targets...).update(context.Background())
+
+	if err == nil || !strings.Contains(err.Error(), "one.com (A)") {
+		t.Errorf("Expected error for one.com; got: %v", err)
+	}
+	if len(working.updates) != 1 {
+		t.Errorf("Got update calls: %v; want: 1", len(working.updates))
+	}
+	if targets[0].last.IsValid() {
+		t.Errorf("Got last IP for failed record: %v; want: none", targets[0].last)
+	}
+	if targets[1].last.String() != "10.0.0.1" {
+		t.Errorf("Got last IP: %v; want: 10.0.0.1", targets[1].last)
+	}
+}
+
+// Expect A records to be updated with the IPv4 address and AAAA records with the IPv6 address.
+func TestUpdateDualStack(t *testing.T) {
+	ihs := map[ipaddress.Family]ipaddress.IPAddressHandler{
+		ipaddress.IPv4: &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}},
+		ipaddress.IPv6: &fakeIPAddressHandler{ips: []string{"2001:db8::1"}, onLast: func() {}},
+	}
+	v4 := &fakeDNSHandler{}
+	v6 := &fakeDNSHandler{}
+	targets := []*target{
+		{record: config.Record{Domain: "one.com", Type: "A"}, handler: v4, family: ipaddress.IPv4},
+		{record: config.Record{Domain: "one.com", Type: "AAAA"}, handler: v6, family: ipaddress.IPv6},
+	}
+
+	u := newTestUpdater(nil, targets...)
+	u.ipHandlers = ihs
+	if _, err := u.update(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(v4.updates) != 1 || v4.updates[0].String() != "10.0.0.1" {
+		t.Errorf("Got A record updates: %v; want: [10.0.0.1]", v4.updates)
+	}
+	if len(v6.updates) != 1 || v6.updates[0].String() != "2001:db8::1" {
+		t.Errorf("Got AAAA record updates: %v; want: [2001:db8::1]", v6.updates)
+	}
+}
+
+// Expect an address of the wrong family from a source to be refused rather than published.
+func TestUpdateRefusesMismatchedFamily(t *testing.T) {
+	ihs := map[ipaddress.Family]ipaddress.IPAddressHandler{
+		ipaddress.IPv4: &fakeIPAddressHandler{ips: []string{"2001:db8::1"}, onLast: func() {}},
+	}
+	dh := &fakeDNSHandler{}
+	targets := []*target{{record: config.Record{Domain: "one.com", Type: "A"}, handler: dh}}
+
+	u := newTestUpdater(nil, targets...)
+	u.ipHandlers = ihs
+	_, err := u.update(context.Background())
+
+	if err == nil || !strings.Contains(err.Error(), "expected an IPv4 address") {
+		t.Errorf("Expected family mismatch error; got: %v", err)
+	}
+	if len(dh.updates) != 0 {
+		t.Errorf("Got update calls: %v; want: 0", len(dh.updates))
+	}
+}
+
+// Expect the provider not to be contacted if the state file shows the current address was recently
+// published, but to be checked again once the verify interval has passed.
+func TestUpdateSkipsRecordsPublishedInState(t *testing.T) {
+	store, _ := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	ip := netip.MustParseAddr("10.0.0.1")
+	recent := &target{record: config.Record{Domain: "recent.com", Type: "A"}, handler: &fakeDNSHandler{}}
+	stale := &target{record: config.Record{Domain: "stale.com", Type: "A"}, handler: &fakeDNSHandler{}}
+	store.Set(recent.key(), state.Entry{IP: ip, Verified: time.Now()})
+	store.Set(stale.key(), state.Entry{IP: ip, Verified: time.Now().Add(-2 * time.Hour)})
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	u := newTestUpdater(ih, recent, stale)
+	u.state = store
+	u.restoreState()
+
+	if _, err := u.update(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if n := len(recent.handler.(*fakeDNSHandler).updates); n != 0 {
+		t.Errorf("Got recent record update calls: %v; want: 0", n)
+	}
+	if n := len(stale.handler.(*fakeDNSHandler).updates); n != 1 {
+		t.Errorf("Got stale record update calls: %v; want: 1", n)
+	}
+}
+
+// Expect a record to be checked with its provider if its configured settings have changed since the
+// address was published, even within the verify interval, and not again once they are applied.
+func TestUpdateAppliesChangedSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, _ := state.Load(path)
+	ip := netip.MustParseAddr("10.0.0.1")
+	tg := &target{record: config.Record{Domain: "one.com", Type: "A", TTL: 600, Notes: "ddclient"}, handler: &fakeDNSHandler{}}
+	store.Set(tg.key(), state.Entry{IP: ip, Verified: time.Now(), Settings: "ttl=300"})
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	u := newTestUpdater(ih, tg)
+	u.state = store
+	u.restoreState()
+
+	for i := 0; i < 2; i++ {
+		if _, err := u.update(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if n := len(tg.handler.(*fakeDNSHandler).updates); n != 1 {
+		t.Errorf("Got update calls: %v; want: 1", n)
+	}
+	saved, _ := state.Load(path)
+	if e, _ := saved.Get(tg.key()); e.Settings != `ttl=600 notes="ddclient"` {
+		t.Errorf("Got saved settings: %q; want: %q", e.Settings, `ttl=600 notes="ddclient"`)
+	}
+}
+
+// Expect successfully published addresses to be saved to the state file.
+func TestUpdateSavesState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, _ := state.Load(path)
+	tg := &target{record: config.Record{Domain: "one.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{}}
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	u := newTestUpdater(ih, tg)
+	u.state = store
+
+	if _, err := u.update(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	saved, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e, ok := saved.Get("porkbun:one.com/A")
+	if !ok || e.IP.String() != "10.0.0.1" {
+		t.Errorf("Got state entry: %v; want IP: 10.0.0.1", e)
+	}
+}
+
+// Expect a dry run to check every record with its provider, count the pending changes and leave the
+// state file untouched.
+func TestUpdateDryRunReportsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, _ := state.Load(path)
+	tg := &target{record: config.Record{Domain: "one.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{}}
+	store.Set(tg.key(), state.Entry{IP: netip.MustParseAddr("10.0.0.1"), Verified: time.Now()})
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	u := newTestUpdater(ih, tg)
+	u.state = store
+	u.dryRun = true
+	u.restoreState()
+
+	changes, err := u.update(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if changes != 1 {
+		t.Errorf("Got changes: %v; want: 1", changes)
+	}
+	if n := len(tg.handler.(*fakeDNSHandler).updates); n != 1 {
+		t.Errorf("Got update calls: %v; want: 1", n)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected state file not to be written; got: %v", err)
+	}
+}
+
+// Expect an update which takes longer than the run timeout to be aborted.
+func TestUpdateAbortsAfterRunTimeout(t *testing.T) {
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	tg := &target{record: config.Record{Domain: "one.com", Type: "A"}, handler: &fakeDNSHandler{block: true}}
+	u := newTestUpdater(ih, tg)
+	u.runTimeout = 10 * time.Millisecond
+
+	_, err := u.update(context.Background())
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded error; got: %v", err)
+	}
+}
+
+// Expect the outcome of each update to be logged with the record, action, and old and new content.
+func TestUpdateLogsResult(t *testing.T) {
+	var buf bytes.Buffer
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+	tg := &target{record: config.Record{Domain: "one.com", Name: "www", Type: "A"}, handler: &fakeDNSHandler{}}
+	u := newTestUpdater(ih, tg)
+	u.logger, _ = newLogger(&buf, config.Logging{Level: "info", Format: "json"})
+
+	if _, err := u.update(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got, current map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		switch m["msg"] {
+		case "Record changed":
+			got = m
+		case "Current address":
+			current = m
+		}
+	}
+	if got == nil {
+		t.Fatalf("Expected record changed message; got: %v", buf.String())
+	}
+	if current == nil || current["family"] != "IPv4" {
+		t.Errorf("Expected current address message with family IPv4; got: %v", current)
+	}
+	want := map[string]any{"record": "www.one.com", "type": "A", "action": "update", "old": "", "new": "10.0.0.1"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Got %s: %v; want: %v", k, got[k], v)
+		}
+	}
+}
+
+// Expect changed records to be notified, and a record which keeps failing to only be notified once.
+func TestUpdateSendsNotifications(t *testing.T) {
+	var events []notify.Event
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		events = append(events, e)
+	}))
+	defer svr.Close()
+	d, err := notify.New([]config.Notification{{Type: config.NotifyWebhook, URL: svr.URL, FailAfter: 1}}, svr.Client())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ih := &fakeIPAddressHandler{ips: []string{"10.0.0.2"}, onLast: func() {}}
+	changed := &target{record: config.Record{Domain: "one.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{old: "10.0.0.1"}}
+	failing := &target{record: config.Record{Domain: "two.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{failures: 5}}
+	u := newTestUpdater(ih, changed, failing)
+	u.notifier = d
+
+	u.update(context.Background())
+	u.update(context.Background())
+
+	if len(events) != 2 {
+		t.Fatalf("Got events: %v; want: 2", events)
+	}
+	if e := events[0]; e.Kind != config.EventChanged || e.Record != "one.com" || e.OldIP != "10.0.0.1" || e.NewIP != "10.0.0.2" {
+		t.Errorf("Got: %v; want changed event for one.com from 10.0.0.1 to 10.0.0.2", e)
+	}
+	if e := events[1]; e.Kind != config.EventFailed || e.Record != "two.com" || e.Failures != 1 || e.Error == "" {
+		t.Errorf("Got: %v; want failed event for two.com", e)
+	}
+}
+
+// Expect consecutive failures to be counted across separate runs sharing a state file, so that a
+// record which keeps failing is only notified once, and the count to be reset by a success.
+func TestUpdateCountsFailuresAcrossRuns(t *testing.T) {
+	var events []notify.Event
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		events = append(events, e)
+	}))
+	defer svr.Close()
+	d, err := notify.New([]config.Notification{{Type: config.NotifyWebhook, URL: svr.URL, FailAfter: 2}}, svr.Client())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	run := func(failures int) *target {
+		store, err := state.Load(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ih := &fakeIPAddressHandler{ips: []string{"10.0.0.1"}, onLast: func() {}}
+		tg := &target{record: config.Record{Domain: "one.com", Type: "A"}, provider: "porkbun", handler: &fakeDNSHandler{failures: failures}}
+		u := newTestUpdater(ih, tg)
+		u.notifier = d
+		u.state = store
+		u.restoreState()
+		u.update(context.Background())
+		return tg
+	}
+
+	for i := 0; i < 3; i++ {
+		run(1)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Got events: %v; want: 1", events)
+	}
+	if e := events[0]; e.Kind != config.EventFailed || e.Failures != 2 {
+		t.Errorf("Got: %v; want failed event after 2 failures", e)
+	}
+
+	run(0)
+	store, _ := state.Load(path)
+	if e, _ := store.Get("porkbun:one.com/A"); e.Failures != 0 || e.IP.String() != "10.0.0.1" {
+		t.Errorf("Got state after success: %+v; want no failures", e)
+	}
+}
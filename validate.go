@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/notify"
+)
+
+// validate checks the configuration built by cfgS, and that the HTTP client, address sources,
+// DNS handlers and notifications can all be set up from it, without making any requests or
+// resolving secrets given as references. Each problem found, and each warning, is written to w on
+// its own line. It returns the exit code.
+func validate(cfgS config.Service, w io.Writer) int {
+	cfg, err := cfgS.ValidateConfig()
+	for _, warning := range cfgS.Warnings() {
+		fmt.Fprintln(w, "Warning:", warning)
+	}
+	var ve *config.ValidationError
+	if errors.As(err, &ve) {
+		for _, fe := range ve.Errors {
+			fmt.Fprintln(w, fe)
+		}
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	logger, err := newLogger(w, cfg.Logging)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	var problems []error
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("http: %w", err))
+	}
+	if _, err := newIPAddressHandlers(cfg, client); err != nil {
+		problems = append(problems, fmt.Errorf("ip address source: %w", err))
+	}
+	if _, err := newTargets(cfg, client, logger, nil, false); err != nil {
+		problems = append(problems, fmt.Errorf("dns: %w", err))
+	}
+	if _, err := notify.New(cfg.Notifications, client); err != nil {
+		problems = append(problems, fmt.Errorf("notifications: %w", err))
+	}
+	if problems != nil {
+		for _, p := range problems {
+			fmt.Fprintln(w, p)
+		}
+		return 1
+	}
+	fmt.Fprintln(w, "Configuration is valid")
+	return 0
+}
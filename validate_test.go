@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhorvath/ddclient/config"
+	"github.com/bhorvath/ddclient/mock"
+)
+
+// Expect a valid config to be reported as such.
+func TestValidateSucceeds(t *testing.T) {
+	var out bytes.Buffer
+	code := validate(config.NewService(mock.GetAppArgs()), &out)
+
+	if code != 0 {
+		t.Errorf("Got exit code: %v; want: 0; output: %v", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Configuration is valid") {
+		t.Errorf("Expected config to be valid; got: %v", out.String())
+	}
+}
+
+// Expect each problem with an invalid config to be written on its own line.
+func TestValidateReportsEachProblem(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.Type = "MX"
+	a.Domain = "internet"
+	var out bytes.Buffer
+	code := validate(config.NewService(a), &out)
+
+	if code != 1 {
+		t.Errorf("Got exit code: %v; want: 1", code)
+	}
+	want := "domain \"internet\" is not a valid domain name\ntype \"MX\" not supported; must be one of A, AAAA\n"
+	if out.String() != want {
+		t.Errorf("Got: %q; want: %q", out.String(), want)
+	}
+}
+
+// Expect a problem setting up an address source to be reported.
+func TestValidateReportsUnknownSource(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.IPv4Sources = []string{"crystal-ball"}
+	var out bytes.Buffer
+	code := validate(config.NewService(a), &out)
+
+	if code != 1 || !strings.Contains(out.String(), "ip address source") {
+		t.Errorf("Got exit code: %v; output: %v", code, out.String())
+	}
+}
+
+// Expect records using a provider which has not been registered to be reported.
+func TestValidateReportsUnknownProvider(t *testing.T) {
+	a := mock.GetAppArgs()
+	a.Provider = "unknown"
+	var out bytes.Buffer
+	code := validate(config.NewService(a), &out)
+
+	if want := `unknown DNS provider "unknown"; must be one of cloudflare, porkbun, rfc2136`; code != 1 || !strings.Contains(out.String(), want) {
+		t.Errorf("Got exit code: %v; output: %v; want: %v", code, out.String(), want)
+	}
+}
+
+// Expect secret commands not to be run while validating.
+func TestValidateDoesNotRunSecretCommands(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	a := mock.GetAppArgs()
+	a.APIKey = "cmd:touch " + marker
+	var out bytes.Buffer
+	code := validate(config.NewService(a), &out)
+
+	if code != 0 {
+		t.Errorf("Got exit code: %v; want: 0; output: %v", code, out.String())
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected secret command not to be run")
+	}
+}
+
+// Expect warnings about the config to be written to the output.
+func TestValidateReportsWarnings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ddclient.json")
+	os.WriteFile(path, []byte("{}"), 0644)
+	os.Chmod(path, 0644)
+	a := mock.GetAppArgs()
+	a.ConfigFilePath = path
+	var out bytes.Buffer
+	code := validate(config.NewService(a), &out)
+
+	if code != 0 {
+		t.Errorf("Got exit code: %v; want: 0; output: %v", code, out.String())
+	}
+	want := "Warning: Config file is accessible by other users - consider chmod 600 file=" + path + " mode=0644\n"
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("Got: %q; want prefix: %q", out.String(), want)
+	}
+}